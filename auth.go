@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	customMastodon "github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/mastodon"
+	"github.com/mattn/go-mastodon"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// RegisterCommand registers the bot as an application on the Mastodon server and logs in
+// with the out-of-band authorization code flow, saving the credentials to the config file
+type RegisterCommand struct {
+	ClientName string `long:"client-name" description:"Application name shown on the server and on the bot's posts" default:"gMapsToOSM"`
+	Website    string `long:"website" description:"Application website shown on the server" default:"https://github.com/RichardoC/gMapsToOSM-mastodon-bot"`
+}
+
+// Run registers the application on opts.Server, asks the user to authorize it and reads the
+// authorization code from in, then writes the credentials to opts.Config. It returns the process exit code
+func (c *RegisterCommand) Run(ctx context.Context, opts Options, in io.Reader, out io.Writer, logger *zap.SugaredLogger) int {
+	if opts.Config == "" {
+		logger.Error("register needs --config (or GMAPS2OSM_CONFIG) to write the credentials to")
+		return 1
+	}
+
+	app, err := customMastodon.RegisterApp(ctx, opts.Server, c.ClientName, c.Website)
+	if err != nil {
+		logger.Errorw("Failed to register application", "server", opts.Server, "error", err)
+		return 1
+	}
+	logger.Infow("Registered application", "server", opts.Server, "clientID", app.ClientID)
+
+	fmt.Fprintf(out, "Log in as the bot account and authorize the application at:\n\n%s\n\nThen paste the authorization code here: ", app.AuthURI)
+
+	code, err := bufio.NewReader(in).ReadString('\n')
+	code = strings.TrimSpace(code)
+	if code == "" {
+		if err == nil {
+			err = errors.New("no authorization code given")
+		}
+		logger.Errorw("Failed to read authorization code", "error", err)
+		return 1
+	}
+
+	client := mastodon.NewClient(&mastodon.Config{
+		Server:       opts.Server,
+		ClientID:     app.ClientID,
+		ClientSecret: app.ClientSecret,
+	})
+	if err := client.GetUserAccessToken(ctx, code, app.RedirectURI); err != nil {
+		logger.Errorw("Failed to exchange authorization code for an access token", "error", err)
+		return 1
+	}
+
+	account, err := client.GetAccountCurrentUser(ctx)
+	if err != nil {
+		logger.Errorw("Failed to verify the new access token", "error", err)
+		return 1
+	}
+
+	err = writeCredentials(opts.Config, client.Config)
+	if err != nil {
+		logger.Errorw("Failed to write credentials", "config", opts.Config, "error", err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "\nLogged in as @%s, credentials written to %s\n", account.Acct, opts.Config)
+	return 0
+}
+
+// VerifyCommand checks the configured credentials work and the access token has the scopes the bot needs
+type VerifyCommand struct{}
+
+// Run checks the credentials in config, writing what it found to out, and returns the process
+// exit code. It fails if the token is invalid or missing any of the required scopes
+func (c *VerifyCommand) Run(ctx context.Context, config *mastodon.Config, out io.Writer, logger *zap.SugaredLogger) int {
+	client := mastodon.NewClient(config)
+
+	account, err := client.GetAccountCurrentUser(ctx)
+	if err != nil {
+		logger.Errorw("Failed to verify credentials", "server", config.Server, "error", err)
+		return 1
+	}
+	fmt.Fprintf(out, "Authenticated as @%s on %s\n", account.Acct, config.Server)
+
+	granted, err := customMastodon.TokenScopes(ctx, client)
+	if err != nil {
+		logger.Errorw("Failed to look up the access token's scopes", "error", err)
+		return 1
+	}
+	fmt.Fprintf(out, "Granted scopes: %s\n", strings.Join(granted, " "))
+
+	if missing := customMastodon.MissingScopes(granted); len(missing) > 0 {
+		fmt.Fprintf(out, "Missing scopes: %s\n", strings.Join(missing, " "))
+		return 1
+	}
+
+	fmt.Fprintln(out, "All required scopes granted")
+	return 0
+}
+
+// secretFileOptions are the config file options which would conflict with credentials written by register
+var secretFileOptions = []string{"client-secret-file", "access-token-file"}
+
+// writeCredentials sets the server and credentials in the YAML config file at path, creating it if
+// needed. Other options and comments in the file are kept
+func writeCredentials(path string, config *mastodon.Config) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid config file %s: expected a mapping of option names to values", path)
+	}
+
+	// Drop secret files, they would conflict with the secrets written here
+	for i := 0; i+1 < len(mapping.Content); {
+		if slices.Contains(secretFileOptions, mapping.Content[i].Value) {
+			mapping.Content = slices.Delete(mapping.Content, i, i+2)
+			continue
+		}
+		i += 2
+	}
+
+	setConfigValue(mapping, "server", config.Server)
+	setConfigValue(mapping, "client-id", config.ClientID)
+	setConfigValue(mapping, "client-secret", config.ClientSecret)
+	setConfigValue(mapping, "access-token", config.AccessToken)
+
+	data, err = yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so the config is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Keep an existing file's mode and ownership, which may share it with a service user or group.
+	// CreateTemp restricts new files to their owner, as they now contain secrets
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := chownLike(tmp, info); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to keep the ownership of %s: %w", path, err)
+		}
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// setConfigValue sets key to value in mapping, replacing any existing value
+func setConfigValue(mapping *yaml.Node, key, value string) {
+	valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = valueNode
+			return
+		}
+	}
+
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+}
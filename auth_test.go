@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+)
+
+// newFakeOAuthServer serves just enough of the Mastodon API to register an app and log in,
+// granting the given scopes
+func newFakeOAuthServer(t *testing.T, scopes string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/apps", func(w http.ResponseWriter, r *http.Request) {
+		// Handlers run off the test goroutine, so they can't stop the test
+		if !assert.NoError(t, r.ParseForm()) {
+			http.Error(w, `{"error":"invalid form"}`, http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "read:notifications read:statuses profile write:notifications write:statuses", r.PostForm.Get("scopes"))
+		assert.Equal(t, "urn:ietf:wg:oauth:2.0:oob", r.PostForm.Get("redirect_uris"))
+		w.Write([]byte(`{"id":"1","client_id":"the-client","client_secret":"the-secret","redirect_uri":"urn:ietf:wg:oauth:2.0:oob"}`))
+	})
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, r.ParseForm()) {
+			http.Error(w, `{"error":"invalid form"}`, http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("code") != "the-code" || r.PostForm.Get("client_secret") != "the-secret" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"the-token","token_type":"Bearer","scope":"` + scopes + `"}`))
+	})
+	mux.HandleFunc("GET /api/v1/accounts/verify_credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer the-token" {
+			http.Error(w, `{"error":"The access token is invalid"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":"42","username":"gMapsToOSM","acct":"gMapsToOSM"}`))
+	})
+	mux.HandleFunc("GET /oauth/token/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"scope":"` + scopes + `"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegisterCommandWritesCredentials(t *testing.T) {
+	server := newFakeOAuthServer(t, "read write")
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("# Tuned for the pi\npoll-interval: 2m\naccess-token-file: /run/secrets/token\n"), 0600))
+
+	cmd := RegisterCommand{ClientName: "gMapsToOSM"}
+	opts := Options{Server: server.URL, Config: configFile}
+
+	var out bytes.Buffer
+	code := cmd.Run(context.Background(), opts, strings.NewReader("the-code\n"), &out, zaptest.NewLogger(t).Sugar())
+	require.Equal(t, 0, code, out.String())
+	assert.Contains(t, out.String(), server.URL+"/oauth/authorize?")
+	assert.Contains(t, out.String(), "Logged in as @gMapsToOSM")
+
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# Tuned for the pi")
+
+	var written map[string]string
+	require.NoError(t, yaml.Unmarshal(data, &written))
+	assert.Equal(t, map[string]string{
+		"poll-interval": "2m",
+		"server":        server.URL,
+		"client-id":     "the-client",
+		"client-secret": "the-secret",
+		"access-token":  "the-token",
+	}, written)
+
+	info, err := os.Stat(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestWriteCredentialsKeepsFileMode(t *testing.T) {
+	config := &mastodon.Config{Server: "https://c.im", ClientID: "id", ClientSecret: "secret", AccessToken: "token"}
+
+	shared := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(shared, []byte("poll-interval: 2m\n"), 0600))
+	require.NoError(t, os.Chmod(shared, 0640))
+
+	require.NoError(t, writeCredentials(shared, config))
+	info, err := os.Stat(shared)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm(), "An existing file keeps its mode")
+
+	created := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, writeCredentials(created, config))
+	info, err = os.Stat(created)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "A new file is only readable by its owner")
+}
+
+func TestRegisterCommandRejectsBadCode(t *testing.T) {
+	server := newFakeOAuthServer(t, "read write")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+
+	cmd := RegisterCommand{ClientName: "gMapsToOSM"}
+	opts := Options{Server: server.URL, Config: configFile}
+
+	var out bytes.Buffer
+	assert.Equal(t, 1, cmd.Run(context.Background(), opts, strings.NewReader("wrong\n"), &out, zaptest.NewLogger(t).Sugar()))
+	assert.NoFileExists(t, configFile)
+}
+
+func TestVerifyCommand(t *testing.T) {
+	testCases := []struct {
+		name         string
+		scopes       string
+		expectCode   int
+		expectOutput string
+	}{
+		{name: "all scopes", scopes: "read write", expectCode: 0, expectOutput: "All required scopes granted"},
+		{name: "missing scopes", scopes: "read", expectCode: 1, expectOutput: "Missing scopes: write:notifications write:statuses"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeOAuthServer(t, tc.scopes)
+
+			var out bytes.Buffer
+			code := (&VerifyCommand{}).Run(context.Background(), &mastodon.Config{Server: server.URL, AccessToken: "the-token"}, &out, zaptest.NewLogger(t).Sugar())
+			assert.Equal(t, tc.expectCode, code)
+			assert.Contains(t, out.String(), "Authenticated as @gMapsToOSM")
+			assert.Contains(t, out.String(), tc.expectOutput)
+		})
+	}
+}
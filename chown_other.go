@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chownLike does nothing where files don't have Unix owners and groups
+func chownLike(f *os.File, info fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mattn/go-mastodon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCredentialsKeepsOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing a file's owner needs root")
+	}
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("poll-interval: 2m\n"), 0640))
+	require.NoError(t, os.Chown(configFile, 1234, 5678))
+
+	require.NoError(t, writeCredentials(configFile, &mastodon.Config{Server: "https://c.im", AccessToken: "token"}))
+	info, err := os.Stat(configFile)
+	require.NoError(t, err)
+	stat := info.Sys().(*syscall.Stat_t)
+	assert.Equal(t, uint32(1234), stat.Uid)
+	assert.Equal(t, uint32(5678), stat.Gid)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-mastodon"
+	"github.com/thought-machine/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variable for every option, e.g. GMAPS2OSM_ACCESS_TOKEN
+const envPrefix = "GMAPS2OSM_"
+
+// configFileOptions finds the config file before the full command line is parsed, as its
+// contents become the defaults the command line and environment are parsed against
+type configFileOptions struct {
+	Config string `long:"config" env:"GMAPS2OSM_CONFIG"`
+}
+
+// findConfigFile returns the config file named by --config or GMAPS2OSM_CONFIG, if any
+func findConfigFile(args []string) (string, error) {
+	var opts configFileOptions
+	_, err := flags.NewParser(&opts, flags.IgnoreUnknown).ParseArgs(args)
+	if err != nil {
+		return "", err
+	}
+	return opts.Config, nil
+}
+
+// loadConfigFile reads the YAML config file at path, which maps long option names to values, and
+// makes its values the defaults of parser's options. Anything on the command line or in the
+// environment still takes precedence
+func loadConfigFile(parser *flags.Parser, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]any
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for name, value := range values {
+		option := parser.FindOptionByLongName(name)
+		if option == nil || name == "config" {
+			return fmt.Errorf("invalid config file %s: unknown option %q", path, name)
+		}
+
+		switch value.(type) {
+		case map[string]any, []any:
+			return fmt.Errorf("invalid config file %s: option %q must be a single value", path, name)
+		case nil:
+			continue
+		}
+
+		option.Default = []string{fmt.Sprint(value)}
+	}
+
+	return nil
+}
+
+// Where an option's value came from, in increasing order of precedence. Defaults and the config
+// file share the lowest, as the config file's values are applied as defaults
+const (
+	fromDefaultOrConfigFile = iota
+	fromEnvironment
+	fromCommandLine
+)
+
+// optionPrecedence returns where each option parsed by parser, by long name, got its value from
+func optionPrecedence(parser *flags.Parser) func(name string) int {
+	return func(name string) int {
+		option := parser.FindOptionByLongName(name)
+		if option == nil {
+			return fromDefaultOrConfigFile
+		}
+		if !option.IsSetDefault() {
+			return fromCommandLine
+		}
+		if _, ok := os.LookupEnv(option.EnvKeyWithNamespace()); ok {
+			return fromEnvironment
+		}
+		return fromDefaultOrConfigFile
+	}
+}
+
+// resolveSecretFiles reads the secrets given as files, as provided by systemd credentials and Docker
+// secrets, into opts. When a secret is given both directly and as a file, whichever came from the
+// higher precedence source, as reported by precedence, wins. They may not both come from the same one
+func (opts *Options) resolveSecretFiles(precedence func(name string) int) error {
+	secrets := []struct {
+		name  string
+		value *string
+		file  string
+	}{
+		{name: "client-secret", value: &opts.ClientSecret, file: opts.ClientSecretFile},
+		{name: "access-token", value: &opts.AccessToken, file: opts.AccessTokenFile},
+	}
+
+	for _, secret := range secrets {
+		if secret.file == "" {
+			continue
+		}
+		if *secret.value != "" {
+			valuePrecedence, filePrecedence := precedence(secret.name), precedence(secret.name+"-file")
+			if valuePrecedence == filePrecedence {
+				return fmt.Errorf("only one of --%s and --%s-file may be set", secret.name, secret.name)
+			}
+			if valuePrecedence > filePrecedence {
+				continue
+			}
+		}
+
+		data, err := os.ReadFile(secret.file)
+		if err != nil {
+			return fmt.Errorf("failed to read --%s-file: %w", secret.name, err)
+		}
+
+		*secret.value = strings.TrimSpace(string(data))
+		if *secret.value == "" {
+			return fmt.Errorf("--%s-file %s is empty", secret.name, secret.file)
+		}
+	}
+
+	return nil
+}
+
+// stateFileName is the name of the state file in the default state directory
+const stateFileName = "gMapsToOSM.db"
+
+// resolveStateFile defaults --state-file to a per-user state directory, rather than the working
+// directory, which is / for services. That is systemd's StateDirectory= when it is set, otherwise
+// $XDG_STATE_HOME/gMapsToOSM or ~/.local/state/gMapsToOSM, which is created if needed
+func (opts *Options) resolveStateFile() error {
+	if opts.StateFile != "" {
+		return nil
+	}
+
+	// systemd separates several state directories with colons
+	if dir, _, _ := strings.Cut(os.Getenv("STATE_DIRECTORY"), ":"); dir != "" {
+		opts.StateFile = filepath.Join(dir, stateFileName)
+		return nil
+	}
+
+	// Relative paths in $XDG_STATE_HOME are invalid and ignored
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(stateHome) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("no state directory to keep the state file in, --state-file must be set: %w", err)
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	dir := filepath.Join(stateHome, "gMapsToOSM")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	opts.StateFile = filepath.Join(dir, stateFileName)
+	return nil
+}
+
+// validateBot checks that opts has everything needed to run the bot
+func (opts *Options) validateBot() error {
+	var errs []error
+	if opts.Server == "" {
+		errs = append(errs, errors.New("--server must be set"))
+	}
+	if opts.AccessToken == "" {
+		errs = append(errs, fmt.Errorf("--access-token or --access-token-file must be set (or %sACCESS_TOKEN or %sACCESS_TOKEN_FILE)", envPrefix, envPrefix))
+	}
+	return errors.Join(errs...)
+}
+
+// validateHealthMaxAge checks that /healthz hears the bot is working more often than
+// --health-max-age, so it isn't reported unhealthy between successful polls. Polls are up to the
+// jitter more than --poll-interval apart, and a quiet stream is only backfilled every
+// streamBackfillPolls intervals
+func (opts *Options) validateHealthMaxAge() error {
+	if opts.Streaming {
+		if backfillInterval := opts.PollInterval * streamBackfillPolls; opts.HealthMaxAge <= backfillInterval {
+			return fmt.Errorf("--health-max-age %v must be longer than the backfill interval of %v while streaming", opts.HealthMaxAge, backfillInterval)
+		}
+		return nil
+	}
+
+	if pollInterval := opts.PollInterval + maxPollJitter(opts.PollInterval); opts.HealthMaxAge <= pollInterval {
+		return fmt.Errorf("--health-max-age %v must be longer than --poll-interval with jitter, %v", opts.HealthMaxAge, pollInterval)
+	}
+	return nil
+}
+
+// mastodonConfig returns the Mastodon client configuration from opts
+func (opts *Options) mastodonConfig() *mastodon.Config {
+	return &mastodon.Config{
+		Server:       opts.Server,
+		ClientID:     opts.ClientID,
+		ClientSecret: opts.ClientSecret,
+		AccessToken:  opts.AccessToken,
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thought-machine/go-flags"
+)
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestOptionPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", `
+server: https://from-config.example
+max-redirects: 7
+poll-interval: 2m
+streaming: true
+providers: geo
+`)
+
+	t.Setenv("GMAPS2OSM_MAX_REDIRECTS", "9")
+	t.Setenv("GMAPS2OSM_PROVIDERS", "qwant")
+
+	args := []string{"--config", configFile, "--providers=osmand"}
+
+	found, err := findConfigFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, configFile, found)
+
+	var opts Options
+	parser := flags.NewParser(&opts, flags.None)
+	require.NoError(t, loadConfigFile(parser, found))
+	_, err = parser.ParseArgs(args)
+	require.NoError(t, err)
+
+	// Config file over defaults
+	assert.Equal(t, "https://from-config.example", opts.Server)
+	assert.Equal(t, 2*time.Minute, opts.PollInterval)
+	assert.True(t, opts.Streaming)
+
+	// Environment over config file
+	assert.Equal(t, 9, opts.MaxRedirects)
+
+	// Flags over everything
+	assert.Equal(t, "osmand", opts.Providers)
+
+	// Untouched options keep their defaults
+	assert.Equal(t, 720*time.Hour, opts.StateMaxAge)
+}
+
+func TestLoadConfigFileRejectsUnknownOptions(t *testing.T) {
+	var opts Options
+	parser := flags.NewParser(&opts, flags.None)
+
+	err := loadConfigFile(parser, writeFile(t, "config.yaml", "acess-token: typo\n"))
+	assert.ErrorContains(t, err, `unknown option "acess-token"`)
+
+	err = loadConfigFile(parser, writeFile(t, "config.yaml", "providers: [geo, qwant]\n"))
+	assert.ErrorContains(t, err, `option "providers" must be a single value`)
+
+	err = loadConfigFile(parser, filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestResolveSecretFiles(t *testing.T) {
+	sameSource := func(string) int { return fromDefaultOrConfigFile }
+
+	opts := Options{
+		Server:          "https://c.im",
+		AccessTokenFile: writeFile(t, "token", "s3cret\n"),
+	}
+	require.NoError(t, opts.resolveSecretFiles(sameSource))
+	assert.Equal(t, "s3cret", opts.AccessToken)
+	assert.NoError(t, opts.validateBot())
+
+	opts = Options{
+		ClientSecret:     "inline",
+		ClientSecretFile: writeFile(t, "secret", "from-file"),
+	}
+	assert.ErrorContains(t, opts.resolveSecretFiles(sameSource), "only one of --client-secret and --client-secret-file")
+
+	opts = Options{
+		AccessTokenFile: writeFile(t, "token", "\n"),
+	}
+	assert.ErrorContains(t, opts.resolveSecretFiles(sameSource), "is empty")
+}
+
+func TestSecretFilesFollowOptionPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", `
+access-token: from-config
+client-secret-file: `+writeFile(t, "secret", "from-config-file")+`
+`)
+	t.Setenv("GMAPS2OSM_ACCESS_TOKEN_FILE", writeFile(t, "token", "from-env-file\n"))
+
+	args := []string{"--config", configFile, "--client-secret=from-flag"}
+
+	var opts Options
+	parser := flags.NewParser(&opts, flags.None)
+	require.NoError(t, loadConfigFile(parser, configFile))
+	_, err := parser.ParseArgs(args)
+	require.NoError(t, err)
+
+	require.NoError(t, opts.resolveSecretFiles(optionPrecedence(parser)))
+
+	// A file from the environment beats a value in the config file
+	assert.Equal(t, "from-env-file", opts.AccessToken)
+
+	// A value from the command line beats a file in the config file
+	assert.Equal(t, "from-flag", opts.ClientSecret)
+}
+
+func TestValidateBotRequiresAccessToken(t *testing.T) {
+	opts := Options{Server: "https://c.im"}
+	assert.ErrorContains(t, opts.validateBot(), "--access-token or --access-token-file must be set")
+}
+
+func TestValidateHealthMaxAge(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        Options
+		errContains string
+	}{
+		{
+			name: "Polling with room for jitter",
+			opts: Options{PollInterval: time.Minute, HealthMaxAge: 30 * time.Minute},
+		},
+		{
+			name:        "Polling less often than the maximum age",
+			opts:        Options{PollInterval: 10 * time.Minute, HealthMaxAge: 5 * time.Minute},
+			errContains: "must be longer than --poll-interval with jitter",
+		},
+		{
+			name:        "Polling without room for jitter",
+			opts:        Options{PollInterval: 10 * time.Minute, HealthMaxAge: 10*time.Minute + 30*time.Second},
+			errContains: "must be longer than --poll-interval with jitter",
+		},
+		{
+			name: "Streaming with backfills more often than the maximum age",
+			opts: Options{Streaming: true, PollInterval: time.Minute, HealthMaxAge: 30 * time.Minute},
+		},
+		{
+			name:        "Streaming with backfills less often than the maximum age",
+			opts:        Options{Streaming: true, PollInterval: 3 * time.Minute, HealthMaxAge: 30 * time.Minute},
+			errContains: "must be longer than the backfill interval",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validateHealthMaxAge()
+			if tc.errContains == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.errContains)
+			}
+		})
+	}
+}
+
+func TestResolveStateFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	testCases := []struct {
+		name           string
+		stateFile      string
+		stateDirectory string
+		xdgStateHome   string
+		expected       string
+	}{
+		{
+			name:      "Set explicitly",
+			stateFile: "bot.db",
+			expected:  "bot.db",
+		},
+		{
+			name:           "systemd state directory",
+			stateDirectory: "/var/lib/gmaps2osm:/var/lib/other",
+			xdgStateHome:   "/ignored",
+			expected:       "/var/lib/gmaps2osm/gMapsToOSM.db",
+		},
+		{
+			name:         "XDG state home",
+			xdgStateHome: filepath.Join(home, "xdg"),
+			expected:     filepath.Join(home, "xdg", "gMapsToOSM", "gMapsToOSM.db"),
+		},
+		{
+			name:         "Relative XDG state home is ignored",
+			xdgStateHome: "relative",
+			expected:     filepath.Join(home, ".local", "state", "gMapsToOSM", "gMapsToOSM.db"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("STATE_DIRECTORY", tc.stateDirectory)
+			t.Setenv("XDG_STATE_HOME", tc.xdgStateHome)
+
+			opts := Options{StateFile: tc.stateFile}
+			require.NoError(t, opts.resolveStateFile())
+			assert.Equal(t, tc.expected, opts.StateFile)
+		})
+	}
+
+	assert.DirExists(t, filepath.Join(home, ".local", "state", "gMapsToOSM"), "The default directory is created")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"go.uber.org/zap"
+)
+
+// ConvertCommand converts map links locally, to check what the bot would reply without involving Mastodon
+type ConvertCommand struct {
+	JSON bool `long:"json" description:"Print the conversion results as JSON rather than the reply text"`
+
+	Args struct {
+		Inputs []string `positional-arg-name:"url|text" required:"1" description:"Map links or coordinates, or text containing them"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// convertOutput is what the convert command prints with --json
+type convertOutput struct {
+	Results []reply.ConversionResult `json:"results"`
+	Reply   string                   `json:"reply"`
+}
+
+// Run converts the links in the command's arguments and writes the result to out, returning the
+// process exit code. It fails unless at least one link converted, so it can be used in scripts
+func (c *ConvertCommand) Run(ctx context.Context, replyGen *reply.Generator, out io.Writer, logger *zap.SugaredLogger) int {
+	mapURLs := gmaps.ExtractMapURLs(strings.Join(c.Args.Inputs, " "))
+
+	output := convertOutput{Results: []reply.ConversionResult{}}
+	if len(mapURLs) == 0 {
+		output.Reply = reply.NoLinksReply
+	} else {
+		output.Results = replyGen.Convert(ctx, mapURLs)
+		output.Reply = reply.FormatReply(output.Results)
+	}
+
+	if c.JSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(output); err != nil {
+			logger.Errorw("Failed to write conversion results", "error", err)
+			return 1
+		}
+	} else {
+		fmt.Fprintln(out, output.Reply)
+	}
+
+	for _, result := range output.Results {
+		if result.Error == nil {
+			return 0
+		}
+	}
+	return 1
+}
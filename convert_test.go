@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply/replytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestConvertCommand(t *testing.T) {
+	testCases := []struct {
+		name         string
+		json         bool
+		inputs       []string
+		expectCode   int
+		expectOutput string
+	}{
+		{
+			name:         "Text output",
+			inputs:       []string{"https://maps.google.com/maps?q=51.5074,-0.1278"},
+			expectCode:   0,
+			expectOutput: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\nSuccessfully converted Google Maps link https://maps.google.com/maps?q=51.5074,-0.1278 to https://osmapp.org/51.5074,-0.1278\n",
+		},
+		{
+			name:         "Arguments are scanned as text",
+			inputs:       []string{"meet", "at", "https://www.google.com/maps/search/restaurants"},
+			expectCode:   1,
+			expectOutput: "Couldn't convert map link(s) to OpenStreetMap\n",
+		},
+		{
+			name:         "No links",
+			json:         true,
+			inputs:       []string{"hello"},
+			expectCode:   1,
+			expectOutput: "{\n  \"results\": [],\n  \"reply\": \"No map links found\"\n}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			replyGen := replytest.NewGenerator(t, "osmapp", reply.Options{})
+
+			cmd := ConvertCommand{JSON: tc.json}
+			cmd.Args.Inputs = tc.inputs
+
+			var out bytes.Buffer
+			code := cmd.Run(context.Background(), replyGen, &out, logger)
+
+			assert.Equal(t, tc.expectCode, code)
+			assert.Equal(t, tc.expectOutput, out.String())
+		})
+	}
+}
+
+func TestConvertCommandJSON(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	replyGen := replytest.NewGenerator(t, "osmapp", reply.Options{})
+
+	cmd := ConvertCommand{JSON: true}
+	cmd.Args.Inputs = []string{"https://www.google.com/maps/@51.558,2.218,15z"}
+
+	var out bytes.Buffer
+	require.Equal(t, 0, cmd.Run(context.Background(), replyGen, &out, logger))
+
+	var output struct {
+		Results []struct {
+			OriginalURL string       `json:"original_url"`
+			Links       []reply.Link `json:"links"`
+		} `json:"results"`
+		Reply string `json:"reply"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &output))
+	require.Len(t, output.Results, 1)
+	assert.Equal(t, "https://www.google.com/maps/@51.558,2.218,15z", output.Results[0].OriginalURL)
+	assert.Equal(t, []reply.Link{{Provider: "osmapp", URL: "https://osmapp.org/51.558,2.218"}}, output.Results[0].Links)
+	assert.Contains(t, output.Reply, "Successfully converted")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/api"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/health"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"go.uber.org/zap"
+)
+
+// newHTTPHandler routes the endpoints served on --http-listen
+func newHTTPHandler(replyGen *reply.Generator, tracker *health.Tracker, logger *zap.SugaredLogger) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", api.NewHandler(replyGen, logger))
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", tracker.LivenessHandler())
+	mux.Handle("GET /readyz", tracker.ReadinessHandler())
+	return mux
+}
+
+// serveHTTP serves handler on listener until ctx is cancelled, then lets in-flight requests finish
+// for up to shutdownTimeout. The returned channel receives the outcome once the server has stopped
+func serveHTTP(ctx context.Context, listener net.Listener, handler http.Handler, shutdownTimeout time.Duration, logger *zap.SugaredLogger) <-chan error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          zap.NewStdLog(logger.Desugar()),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Infow("Serving HTTP", "address", listener.Addr().String())
+		serveErr <- server.Serve(listener)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		select {
+		case err := <-serveErr:
+			// Serve only returns early if the listener failed
+			logger.Errorw("HTTP server stopped", "error", err)
+			done <- err
+			return
+		case <-ctx.Done():
+		}
+
+		logger.Info("Shutting down HTTP server")
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+
+		err := server.Shutdown(shutdownCtx)
+		if serveErr := <-serveErr; !errors.Is(serveErr, http.ErrServerClosed) {
+			err = errors.Join(err, serveErr)
+		}
+		done <- err
+	}()
+
+	return done
+}
@@ -2,15 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	zlog "log"
 	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/health"
 	customMastodon "github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/mastodon"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/osm"
 	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/ratelimit"
 	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/store"
 	"github.com/mattn/go-mastodon"
 	"github.com/thought-machine/go-flags"
 	"go.uber.org/automaxprocs/maxprocs"
@@ -18,58 +30,169 @@ import (
 )
 
 type Options struct {
-	Server       string        `long:"server" description:"Mastodon server to connect to" default:"https://c.im"`
-	ClientID     string        `long:"client-id" description:"Mastodon application client ID"`
-	ClientSecret string        `long:"client-secret" description:"Mastodon application client secret"`
-	AccessToken  string        `long:"access-token" description:"Mastodon application access token"`
-	Verbose      bool          `long:"verbosity" short:"v" description:"Uses zap Development default verbose mode rather than production"`
-	MaxRedirects int           `long:"max-redirects" description:"Maximum number of HTTP redirects to follow" default:"5"`
-	PollInterval time.Duration `long:"poll-interval" description:"How often to poll for new notifications (minimum 60s)" default:"60s"`
+	Config           string        `long:"config" description:"YAML file of option values, keyed by long option name. Environment variables and flags take precedence" env:"GMAPS2OSM_CONFIG"`
+	Server           string        `long:"server" description:"Mastodon server to connect to" default:"https://c.im" env:"GMAPS2OSM_SERVER"`
+	ClientID         string        `long:"client-id" description:"Mastodon application client ID" env:"GMAPS2OSM_CLIENT_ID"`
+	ClientSecret     string        `long:"client-secret" description:"Mastodon application client secret" default-mask:"-" env:"GMAPS2OSM_CLIENT_SECRET"`
+	ClientSecretFile string        `long:"client-secret-file" description:"File containing the Mastodon application client secret, instead of --client-secret" env:"GMAPS2OSM_CLIENT_SECRET_FILE"`
+	AccessToken      string        `long:"access-token" description:"Mastodon application access token" default-mask:"-" env:"GMAPS2OSM_ACCESS_TOKEN"`
+	AccessTokenFile  string        `long:"access-token-file" description:"File containing the Mastodon application access token, instead of --access-token" env:"GMAPS2OSM_ACCESS_TOKEN_FILE"`
+	Verbose          bool          `long:"verbosity" short:"v" description:"Uses zap Development default verbose mode rather than production" env:"GMAPS2OSM_VERBOSITY"`
+	MaxRedirects     int           `long:"max-redirects" description:"Maximum number of HTTP redirects to follow" default:"5" env:"GMAPS2OSM_MAX_REDIRECTS"`
+	RateLimit        float64       `long:"rate-limit" description:"Requests per second to make to each host when resolving links" default:"1" env:"GMAPS2OSM_RATE_LIMIT"`
+	RateBurst        int           `long:"rate-burst" description:"Requests to each host that may be made at once when resolving links, before --rate-limit applies" default:"3" env:"GMAPS2OSM_RATE_BURST"`
+	HTTPRetries      int           `long:"http-retries" description:"How many times to retry resolving a link when the host responds 429 or 503, honouring Retry-After" default:"3" env:"GMAPS2OSM_HTTP_RETRIES"`
+	CacheSize        int           `long:"cache-size" description:"How many resolved short links to remember in memory, 0 to disable the cache" default:"1000" env:"GMAPS2OSM_CACHE_SIZE"`
+	CacheTTL         time.Duration `long:"cache-ttl" description:"How long to remember what a short link resolved to" default:"168h" env:"GMAPS2OSM_CACHE_TTL"`
+	CacheNegativeTTL time.Duration `long:"cache-negative-ttl" description:"How long to remember that a short link couldn't be resolved" default:"10m" env:"GMAPS2OSM_CACHE_NEGATIVE_TTL"`
+	NoCachePersist   bool          `long:"no-cache-persistence" description:"Only remember resolved short links in memory, rather than also in the state file" env:"GMAPS2OSM_NO_CACHE_PERSISTENCE"`
+	PollInterval     time.Duration `long:"poll-interval" description:"How often to poll for new notifications (minimum 60s)" default:"60s" env:"GMAPS2OSM_POLL_INTERVAL"`
+	Streaming        bool          `long:"streaming" description:"Receive mentions from the streaming API, falling back to polling when the stream drops" env:"GMAPS2OSM_STREAMING"`
+	StateFile        string        `long:"state-file" description:"Path to the on-disk record of handled mentions (default: gMapsToOSM.db in $STATE_DIRECTORY, $XDG_STATE_HOME/gMapsToOSM or ~/.local/state/gMapsToOSM)" env:"GMAPS2OSM_STATE_FILE"`
+	StateMaxAge      time.Duration `long:"state-max-age" description:"How long to remember handled mentions" default:"720h" env:"GMAPS2OSM_STATE_MAX_AGE"`
+	DrainTimeout     time.Duration `long:"shutdown-timeout" description:"How long to let in-flight mentions finish after SIGINT or SIGTERM" default:"30s" env:"GMAPS2OSM_SHUTDOWN_TIMEOUT"`
+	Providers        string        `long:"providers" description:"Comma-separated map providers to link to in replies, in order (geo, mapy, openstreetmap, organicmaps, organicmaps-app, osmand, osmapp, qwant)" default:"osmapp,openstreetmap" env:"GMAPS2OSM_PROVIDERS"`
+	KeepGCJ02        bool          `long:"no-gcj02-conversion" description:"Don't convert Google and Apple Maps coordinates in mainland China from GCJ-02 to WGS-84" env:"GMAPS2OSM_NO_GCJ02_CONVERSION"`
+	PlusCodes        bool          `long:"plus-codes" description:"Include the plus code of each converted location in replies" env:"GMAPS2OSM_PLUS_CODES"`
+	DryRun           bool          `long:"dry-run" description:"Log the replies the bot would post instead of posting them, leaving notifications in place" env:"GMAPS2OSM_DRY_RUN"`
+	HTTPListen       string        `long:"http-listen" description:"Address to serve the HTTP conversion API, metrics and health checks on, e.g. :8080 (disabled by default)" env:"GMAPS2OSM_HTTP_LISTEN"`
+	HealthMaxAge     time.Duration `long:"health-max-age" description:"How long since notifications were last processed successfully before /healthz reports unhealthy" default:"30m" env:"GMAPS2OSM_HEALTH_MAX_AGE"`
+}
+
+// BotOptions controls how the bot handles mentions
+type BotOptions struct {
+	// Streaming subscribes to the streaming API rather than only polling
+	Streaming bool
+
+	// DrainTimeout is how long in-flight work may continue after shutdown is requested
+	DrainTimeout time.Duration
+
+	// DryRun logs replies instead of posting them and leaves notifications undismissed
+	DryRun bool
+
+	// Health records the state of the poll loop for health checks. If nil, the state isn't reported
+	Health *health.Tracker
 }
 
 // Bot represents the main bot instance
 type Bot struct {
-	client         *mastodon.Client
+	client         customMastodon.Client
 	replyChecker   *customMastodon.ReplyChecker
 	replyGenerator *reply.Generator
+	store          *store.Store
+	stream         *customMastodon.NotificationStream
+	health         *health.Tracker
 	logger         *zap.SugaredLogger
 	botAccountID   mastodon.ID
+	drainTimeout   time.Duration
+	dryRun         bool
+
+	// dryRunHandled remembers when statuses were handled during a dry run, in place of the state
+	// file, as their notifications are left in place and fetched again by every poll. Pruned along
+	// with the state file. Guarded by mu
+	dryRunHandled map[mastodon.ID]time.Time
+
+	// mu serialises notification handling between the stream and backfill polls
+	mu sync.Mutex
+
+	// drainExpired is set if shutdown cut off in-flight work
+	drainExpired atomic.Bool
 }
 
-// NewBot creates a new bot instance
-func NewBot(config *mastodon.Config, httpClient *ratelimit.RateLimitedClient, logger *zap.SugaredLogger) (*Bot, error) {
-	client := mastodon.NewClient(config)
+// errDrainTimeout is the cause of cancelling in-flight work that didn't finish within the shutdown timeout
+var errDrainTimeout = errors.New("shutdown timeout exceeded before in-flight work finished")
+
+// How long to poll after the stream drops before trying to subscribe again
+const streamRetryPolls = 5
+
+// How often to backfill via polling while the stream is up, in case events were missed
+const streamBackfillPolls = 10
+
+// How often to prune old records from the state file
+const statePruneInterval = 24 * time.Hour
+
+// NewBot creates a new bot instance which talks to Mastodon through client and replies using replyGen.
+// Verifying the bot's credentials gives up if ctx is cancelled
+func NewBot(ctx context.Context, client customMastodon.Client, replyGen *reply.Generator, st *store.Store, opts BotOptions, logger *zap.SugaredLogger) (*Bot, error) {
+	if opts.Health == nil {
+		opts.Health = health.NewTracker(0)
+	}
 
 	// Verify credentials and get bot account ID
-	ctx := context.Background()
 	account, err := client.GetAccountCurrentUser(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Infow("Bot account verified", "username", account.Username, "id", account.ID)
+	opts.Health.CredentialsVerified()
 
 	// Set up components
-	extractor := gmaps.NewExtractor(httpClient, logger)
-	replyGen := reply.NewGenerator(extractor, logger)
 	replyCheck := customMastodon.NewReplyChecker(client, logger)
 
-	return &Bot{
+	bot := &Bot{
 		client:         client,
 		replyChecker:   replyCheck,
 		replyGenerator: replyGen,
+		store:          st,
+		health:         opts.Health,
 		logger:         logger,
 		botAccountID:   account.ID,
-	}, nil
+		drainTimeout:   opts.DrainTimeout,
+		dryRun:         opts.DryRun,
+	}
+	if opts.DryRun {
+		bot.dryRunHandled = make(map[mastodon.ID]time.Time)
+	}
+	if opts.Streaming {
+		bot.stream = customMastodon.NewNotificationStream(client, logger)
+	}
+
+	return bot, nil
+}
+
+// drainContext returns a context for in-flight work which outlives cancellation of parent by up to
+// the shutdown timeout, so work that has started can finish rather than being cut off mid-reply
+func (b *Bot) drainContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+
+	stop := context.AfterFunc(parent, func() {
+		b.logger.Infow("Shutdown requested, finishing in-flight work", "timeout", b.drainTimeout)
+		timer := time.AfterFunc(b.drainTimeout, func() {
+			cancel(errDrainTimeout)
+		})
+		context.AfterFunc(ctx, func() {
+			timer.Stop()
+		})
+	})
+
+	return ctx, func() {
+		stop()
+		if errors.Is(context.Cause(ctx), errDrainTimeout) {
+			b.logger.Warn("In-flight work was cut off by the shutdown timeout")
+			b.drainExpired.Store(true)
+		}
+		cancel(nil)
+	}
 }
 
-// processNotifications fetches and processes all pending mention notifications
+// processNotifications fetches and processes all pending mention notifications. Once ctx is
+// cancelled no further pages are fetched, but the current page is finished
 func (b *Bot) processNotifications(ctx context.Context) error {
+	workCtx, done := b.drainContext(ctx)
+	defer done()
+
 	var pg mastodon.Pagination
 	pg.Limit = 20 // Process up to 20 notifications at a time
 
 	for {
-		notifs, err := b.client.GetNotifications(ctx, &pg)
+		// An unfinished batch doesn't count as success
+		if ctx.Err() != nil {
+			b.logger.Info("Shutting down, not fetching more notifications")
+			return nil
+		}
+
+		notifs, err := b.client.GetNotifications(workCtx, &pg)
 		if err != nil {
 			return err
 		}
@@ -80,27 +203,11 @@ func (b *Bot) processNotifications(ctx context.Context) error {
 		}
 
 		b.logger.Infow("Fetched notifications", "count", len(notifs))
+		metrics.NotificationsFetched.WithLabelValues("poll").Add(float64(len(notifs)))
 
 		// Process each notification
 		for _, notif := range notifs {
-			if notif.Type != "mention" {
-				b.logger.Debugw("Skipping non-mention notification", "type", notif.Type, "id", notif.ID)
-				continue
-			}
-
-			if err := b.processMention(ctx, notif); err != nil {
-				b.logger.Errorw("Failed to process mention", "notificationID", notif.ID, "error", err)
-				// Continue processing other notifications even if one fails
-				continue
-			}
-
-			// Dismiss the notification after successful processing
-			if err := b.client.DismissNotification(ctx, notif.ID); err != nil {
-				b.logger.Warnw("Failed to dismiss notification", "notificationID", notif.ID, "error", err)
-				// Not fatal, continue
-			} else {
-				b.logger.Debugw("Dismissed notification", "notificationID", notif.ID)
-			}
+			b.handleNotification(workCtx, notif)
 		}
 
 		// Check if there are more pages
@@ -109,6 +216,41 @@ func (b *Bot) processNotifications(ctx context.Context) error {
 		}
 	}
 
+	b.health.Succeeded()
+	return nil
+}
+
+// handleNotification processes a single notification, dismissing mentions once they have been handled.
+// It returns the error if a mention couldn't be handled and was left to be retried
+func (b *Bot) handleNotification(ctx context.Context, notif *mastodon.Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if notif.Type != "mention" {
+		b.logger.Debugw("Skipping non-mention notification", "type", notif.Type, "id", notif.ID)
+		return nil
+	}
+
+	if err := b.processMention(ctx, notif); err != nil {
+		b.logger.Errorw("Failed to process mention", "notificationID", notif.ID, "error", err)
+		metrics.MentionsProcessed.WithLabelValues("error").Inc()
+		// Leave the notification in place so the next poll retries it
+		return err
+	}
+	metrics.MentionsProcessed.WithLabelValues("success").Inc()
+
+	if b.dryRun {
+		b.logger.Debugw("Dry run, not dismissing notification", "notificationID", notif.ID)
+		return nil
+	}
+
+	// Dismiss the notification after successful processing
+	if err := b.client.DismissNotification(ctx, notif.ID); err != nil {
+		b.logger.Warnw("Failed to dismiss notification", "notificationID", notif.ID, "error", err)
+		// Not fatal, continue
+	} else {
+		b.logger.Debugw("Dismissed notification", "notificationID", notif.ID)
+	}
 	return nil
 }
 
@@ -122,7 +264,23 @@ func (b *Bot) processMention(ctx context.Context, notif *mastodon.Notification)
 
 	b.logger.Infow("Processing mention", "statusID", status.ID, "from", notif.Account.Username)
 
-	// Check if we've already replied to this status
+	// Check our own records first, they are cheap and survive restarts
+	record, err := b.store.Get(string(status.ID))
+	if err != nil {
+		return err
+	}
+
+	if record != nil {
+		b.logger.Infow("Already handled this status, skipping", "statusID", status.ID, "outcome", record.Outcome, "handledAt", record.HandledAt)
+		return nil
+	}
+
+	if _, ok := b.dryRunHandled[status.ID]; ok {
+		b.logger.Debugw("Already handled this status during the dry run, skipping", "statusID", status.ID)
+		return nil
+	}
+
+	// Fall back to asking the server, in case we replied before the status was recorded
 	alreadyReplied, err := b.replyChecker.HasAlreadyReplied(ctx, status.ID, b.botAccountID)
 	if err != nil {
 		return err
@@ -130,10 +288,11 @@ func (b *Bot) processMention(ctx context.Context, notif *mastodon.Notification)
 
 	if alreadyReplied {
 		b.logger.Infow("Already replied to this status, skipping", "statusID", status.ID)
+		b.recordOutcome(store.Record{StatusID: string(status.ID), Outcome: store.OutcomeAlreadyReplied})
 		return nil
 	}
 
-	// Collect texts to scan for Google Maps URLs
+	// Collect status HTML to scan for map links
 	textsToScan := []string{status.Content}
 
 	// If this is a reply, also check the parent status
@@ -163,7 +322,7 @@ func (b *Bot) processMention(ctx context.Context, notif *mastodon.Notification)
 	}
 
 	// Generate the reply
-	replyText, err := b.replyGenerator.GenerateReply(ctx, textsToScan...)
+	replyText, err := b.replyGenerator.GenerateReplyFromHTML(ctx, textsToScan...)
 	if err != nil {
 		return err
 	}
@@ -175,34 +334,193 @@ func (b *Bot) processMention(ctx context.Context, notif *mastodon.Notification)
 		Visibility:  status.Visibility, // Match the visibility of the original post
 	}
 
+	if b.dryRun {
+		b.logger.Infow("Dry run, not posting reply", "inReplyTo", toot.InReplyToID, "visibility", toot.Visibility, "text", toot.Status)
+		b.recordOutcome(store.Record{StatusID: string(status.ID), Outcome: store.OutcomeReplied})
+		return nil
+	}
+
 	postedStatus, err := b.client.PostStatus(ctx, toot)
 	if err != nil {
 		return err
 	}
 
 	b.logger.Infow("Posted reply", "statusID", postedStatus.ID, "inReplyTo", status.ID, "text", replyText)
+	metrics.RepliesPosted.Inc()
+	b.recordOutcome(store.Record{StatusID: string(status.ID), ReplyID: string(postedStatus.ID), Outcome: store.OutcomeReplied})
 
 	return nil
 }
 
-// Run starts the bot's main polling loop with jitter and exponential backoff
-func (b *Bot) Run(ctx context.Context, basePollInterval time.Duration) {
+// recordOutcome saves how a status was handled. Failures are logged rather than returned,
+// as the server-side reply check still prevents double replies. A dry run only remembers it in
+// memory, leaving the state file untouched. b.mu must be held
+func (b *Bot) recordOutcome(record store.Record) {
+	record.HandledAt = time.Now()
+	if b.dryRun {
+		b.dryRunHandled[mastodon.ID(record.StatusID)] = record.HandledAt
+		return
+	}
+
+	if err := b.store.Put(record); err != nil {
+		b.logger.Errorw("Failed to record handled status", "statusID", record.StatusID, "error", err)
+	}
+}
+
+// pruneState periodically forgets handled statuses older than maxAge until ctx is cancelled
+func (b *Bot) pruneState(ctx context.Context, maxAge time.Duration) {
+	ticker := time.NewTicker(statePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := b.store.Prune(time.Now().Add(-maxAge))
+		if err != nil {
+			b.logger.Errorw("Failed to prune state file", "error", err)
+		} else {
+			b.logger.Debugw("Pruned state file", "removed", pruned)
+		}
+
+		b.pruneDryRunHandled(time.Now().Add(-maxAge))
+
+		pruned, err = b.store.PruneResolutions(time.Now())
+		if err != nil {
+			b.logger.Errorw("Failed to prune cached resolutions", "error", err)
+		} else {
+			b.logger.Debugw("Pruned cached resolutions", "removed", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneDryRunHandled forgets statuses handled during a dry run before cutoff
+func (b *Bot) pruneDryRunHandled(cutoff time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, handledAt := range b.dryRunHandled {
+		if handledAt.Before(cutoff) {
+			delete(b.dryRunHandled, id)
+		}
+	}
+}
+
+// Run starts the bot's main loop, streaming mentions when a stream is configured and polling otherwise.
+// It returns once ctx is cancelled and in-flight work has drained, with an error if the
+// shutdown timeout cut any work off
+func (b *Bot) Run(ctx context.Context, basePollInterval time.Duration) error {
+	if b.stream == nil {
+		b.poll(ctx, basePollInterval, nil)
+		return b.shutdownErr()
+	}
+
+	for {
+		b.runStream(ctx, basePollInterval)
+		if ctx.Err() != nil {
+			return b.shutdownErr()
+		}
+
+		// Fall back to polling for a while, which also backfills anything missed, then resubscribe
+		retryAfter := basePollInterval * streamRetryPolls
+		b.logger.Warnw("Falling back to polling", "retryStreamAfter", retryAfter)
+		b.poll(ctx, basePollInterval, time.After(retryAfter))
+		if ctx.Err() != nil {
+			return b.shutdownErr()
+		}
+	}
+}
+
+// shutdownErr reports whether shutdown completed without cutting off in-flight work
+func (b *Bot) shutdownErr() error {
+	if b.drainExpired.Load() {
+		return errDrainTimeout
+	}
+	return nil
+}
+
+// runStream handles mentions from the notification stream until it drops or ctx is cancelled
+func (b *Bot) runStream(ctx context.Context, basePollInterval time.Duration) {
+	b.logger.Info("Starting notification stream")
+
+	metrics.Streaming.Set(1)
+	defer metrics.Streaming.Set(0)
+
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- b.stream.Stream(ctx, func(ctx context.Context, notif *mastodon.Notification) {
+			metrics.NotificationsFetched.WithLabelValues("stream").Inc()
+
+			// Finish a notification that has started even if shutdown is requested
+			workCtx, done := b.drainContext(ctx)
+			defer done()
+
+			// Notifications handled show the stream is working between backfills
+			if err := b.handleNotification(workCtx, notif); err == nil {
+				b.health.Succeeded()
+			}
+		})
+	}()
+
+	// Backfill anything that arrived while we weren't subscribed
+	if err := b.processNotifications(ctx); err != nil {
+		b.logger.Errorw("Error processing notifications", "error", err)
+	}
+
+	backfill := time.NewTicker(basePollInterval * streamBackfillPolls)
+	defer backfill.Stop()
+
+	for {
+		select {
+		case err := <-streamErr:
+			if ctx.Err() != nil {
+				b.logger.Info("Bot shutting down")
+			} else {
+				b.logger.Warnw("Notification stream dropped", "error", err)
+			}
+			return
+		case <-backfill.C:
+			b.logger.Debug("Backfilling notifications while streaming")
+			if err := b.processNotifications(ctx); err != nil {
+				b.logger.Errorw("Error processing notifications", "error", err)
+			}
+		}
+	}
+}
+
+// maxPollJitter is how far polls may be moved either side of interval, so bots don't poll in lockstep
+func maxPollJitter(interval time.Duration) time.Duration {
+	return interval / 10
+}
+
+// poll runs the notification polling loop with jitter and exponential backoff until ctx is
+// cancelled or stop fires. A nil stop channel polls forever
+func (b *Bot) poll(ctx context.Context, basePollInterval time.Duration, stop <-chan time.Time) {
 	b.logger.Infow("Starting bot polling loop", "baseInterval", basePollInterval)
 
 	currentInterval := basePollInterval
 	consecutiveErrors := 0
 	maxBackoff := basePollInterval * 8 // Max 8x the base interval
 
+	metrics.PollInterval.Set(currentInterval.Seconds())
+	metrics.PollConsecutiveErrors.Set(0)
+	b.health.SetBackoff(currentInterval, consecutiveErrors)
+
 	// Process notifications immediately on startup
 	if err := b.processNotifications(ctx); err != nil {
 		b.logger.Errorw("Error processing notifications", "error", err)
 		consecutiveErrors++
+		metrics.PollConsecutiveErrors.Set(float64(consecutiveErrors))
+		b.health.SetBackoff(currentInterval, consecutiveErrors)
 	}
 
 	// Then continue polling
 	for {
 		// Add jitter: ±10% of current interval
-		jitter := time.Duration(rand.Int63n(int64(currentInterval)/5)) - currentInterval/10
+		jitter := time.Duration(rand.Int63n(2*int64(maxPollJitter(currentInterval)))) - maxPollJitter(currentInterval)
 		nextPoll := currentInterval + jitter
 
 		b.logger.Debugw("Scheduling next poll", "interval", nextPoll, "jitter", jitter)
@@ -211,6 +529,9 @@ func (b *Bot) Run(ctx context.Context, basePollInterval time.Duration) {
 		case <-ctx.Done():
 			b.logger.Info("Bot shutting down")
 			return
+		case <-stop:
+			b.logger.Debug("Stopping polling loop")
+			return
 		case <-time.After(nextPoll):
 			b.logger.Debug("Polling for notifications")
 			if err := b.processNotifications(ctx); err != nil {
@@ -223,12 +544,18 @@ func (b *Bot) Run(ctx context.Context, basePollInterval time.Duration) {
 					currentInterval = maxBackoff
 				}
 				b.logger.Warnw("Backing off due to errors", "newInterval", currentInterval, "consecutiveErrors", consecutiveErrors)
+				metrics.PollInterval.Set(currentInterval.Seconds())
+				metrics.PollConsecutiveErrors.Set(float64(consecutiveErrors))
+				b.health.SetBackoff(currentInterval, consecutiveErrors)
 			} else {
 				// Success - reset to base interval
 				if consecutiveErrors > 0 {
 					b.logger.Infow("Polling successful, resetting interval", "interval", basePollInterval)
 					consecutiveErrors = 0
 					currentInterval = basePollInterval
+					metrics.PollInterval.Set(currentInterval.Seconds())
+					metrics.PollConsecutiveErrors.Set(0)
+					b.health.SetBackoff(currentInterval, consecutiveErrors)
 				}
 			}
 		}
@@ -236,22 +563,84 @@ func (b *Bot) Run(ctx context.Context, basePollInterval time.Duration) {
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run parses the command line and runs the chosen command, returning the process exit code
+func run() int {
 	// Set and parse command line options
 	var opts Options
+	var convertCmd ConvertCommand
+	var registerCmd RegisterCommand
+	var verifyCmd VerifyCommand
 	parser := flags.NewParser(&opts, flags.Default)
-	_, err := parser.Parse()
+	parser.SubcommandsOptional = true
+
+	runCmd, err := parser.AddCommand("run", "Run the Mastodon bot (default)", "Run the Mastodon bot, replying to mentions containing map links. This is what happens when no command is given", &struct{}{})
+	if err != nil {
+		zlog.Fatalf("can't add run command: %v", err)
+	}
+	runCmd.Aliases = []string{"serve"}
+
+	_, err = parser.AddCommand("convert", "Convert map links locally", "Convert the map links in the given URLs or text and print the reply the bot would post, without involving Mastodon", &convertCmd)
+	if err != nil {
+		zlog.Fatalf("can't add convert command: %v", err)
+	}
+
+	_, err = parser.AddCommand("register", "Register the bot on the Mastodon server and log in", "Register an application on --server with the scopes the bot needs, authorize it as the bot account and write the credentials to --config", &registerCmd)
+	if err != nil {
+		zlog.Fatalf("can't add register command: %v", err)
+	}
+
+	_, err = parser.AddCommand("verify", "Check the bot's credentials and scopes", "Check the access token is valid and has every scope the bot needs, exiting non-zero if not", &verifyCmd)
+	if err != nil {
+		zlog.Fatalf("can't add verify command: %v", err)
+	}
+
+	// Options are taken from flags, then environment variables, then the config file, then defaults
+	configFile, err := findConfigFile(os.Args[1:])
+	if err != nil {
+		zlog.Fatalf("can't parse flags: %v", err)
+	}
+	var configErr error
+	if configFile != "" {
+		configErr = loadConfigFile(parser, configFile)
+	}
+
+	_, err = parser.Parse()
 	if err != nil {
 		zlog.Fatalf("can't parse flags: %v", err)
 	}
 
-	var z *zap.Logger
+	command := "run"
+	if parser.Active != nil {
+		command = parser.Active.Name
+	}
+
+	// register creates the config file, so it doesn't have to exist yet
+	if configErr != nil && !(command == "register" && errors.Is(configErr, fs.ErrNotExist)) {
+		zlog.Fatalf("can't load config: %v", configErr)
+	}
+
+	if err := opts.resolveSecretFiles(optionPrecedence(parser)); err != nil {
+		zlog.Fatalf("invalid options: %v", err)
+	}
+
+	if command == "run" || command == "verify" {
+		if err := opts.validateBot(); err != nil {
+			zlog.Fatalf("invalid options: %v", err)
+		}
+	}
 
 	// Configure the logger
+	config := zap.NewProductionConfig()
 	if opts.Verbose {
-		z = zap.Must(zap.NewDevelopment())
-	} else {
-		z = zap.Must(zap.NewProduction())
+		config = zap.NewDevelopmentConfig()
+	} else if command != "run" {
+		// Keep the output readable, only the command's result matters
+		config.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
 	}
+	z := zap.Must(config.Build())
 	defer z.Sync()
 	log := z.Sugar()
 
@@ -260,29 +649,145 @@ func main() {
 	undo := zap.RedirectStdLog(z)
 	defer undo()
 
+	switch command {
+	case "register":
+		return registerCmd.Run(context.Background(), opts, os.Stdin, os.Stdout, log)
+	case "verify":
+		return verifyCmd.Run(context.Background(), opts.mastodonConfig(), os.Stdout, log)
+	}
+
+	var cache *gmaps.ResolutionCache
+	if opts.CacheSize > 0 {
+		cache = gmaps.NewResolutionCache(gmaps.CacheOptions{
+			Size:        opts.CacheSize,
+			TTL:         opts.CacheTTL,
+			NegativeTTL: opts.CacheNegativeTTL,
+		}, log)
+	}
+
+	replyGen, err := newReplyGenerator(opts, cache, log)
+	if err != nil {
+		log.Fatalw("Invalid options", "error", err)
+	}
+
+	if command == "convert" {
+		return convertCmd.Run(context.Background(), replyGen, os.Stdout, log)
+	}
+	return runBot(opts, replyGen, cache, log)
+}
+
+// newReplyGenerator sets up link conversion as configured by opts, remembering resolved links in cache if it isn't nil
+func newReplyGenerator(opts Options, cache *gmaps.ResolutionCache, logger *zap.SugaredLogger) (*reply.Generator, error) {
+	providers, err := osm.ParseProviders(opts.Providers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --providers: %w", err)
+	}
+
+	if opts.RateLimit <= 0 {
+		return nil, fmt.Errorf("invalid --rate-limit %v: must be positive", opts.RateLimit)
+	}
+	if opts.RateBurst < 1 {
+		return nil, fmt.Errorf("invalid --rate-burst %d: must be at least 1", opts.RateBurst)
+	}
+
+	// Create rate-limited HTTP client, with a separate limit per host
+	httpClient := ratelimit.NewRateLimitedClient(ratelimit.Limits{
+		RequestsPerSecond: opts.RateLimit,
+		Burst:             opts.RateBurst,
+		MaxRetries:        opts.HTTPRetries,
+	})
+	extractor := gmaps.NewExtractor(httpClient, opts.MaxRedirects, logger)
+	if cache != nil {
+		extractor.SetCache(cache)
+	}
+
+	return reply.NewGenerator(extractor, reply.Options{
+		Providers: providers,
+		KeepGCJ02: opts.KeepGCJ02,
+		PlusCodes: opts.PlusCodes,
+	}, logger), nil
+}
+
+// runBot runs the bot until it is signalled to stop, returning the process exit code
+func runBot(opts Options, replyGen *reply.Generator, cache *gmaps.ResolutionCache, log *zap.SugaredLogger) int {
 	// Validate poll interval
 	if opts.PollInterval < 60*time.Second {
 		log.Warnw("Poll interval too low, setting to minimum 60s", "requested", opts.PollInterval)
 		opts.PollInterval = 60 * time.Second
 	}
 
-	// Create rate-limited HTTP client (1 request per second)
-	httpClient := ratelimit.NewRateLimitedClient(opts.MaxRedirects, 1.0)
+	if err := opts.validateHealthMaxAge(); err != nil {
+		log.Fatalw("Invalid options", "error", err)
+	}
+
+	// Open the record of handled mentions
+	if err := opts.resolveStateFile(); err != nil {
+		log.Fatalw("Invalid options", "error", err)
+	}
+	st, err := store.Open(opts.StateFile, log)
+	if err != nil {
+		log.Fatalw("Failed to open state file", "error", err)
+	}
+	defer st.Close()
+
+	// Remember resolved links across restarts
+	if cache != nil && !opts.NoCachePersist {
+		cache.Persist(st)
+	}
+
+	// Run the bot until SIGINT or SIGTERM. A second signal kills the process without waiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	tracker := health.NewTracker(opts.HealthMaxAge)
 
-	config := &mastodon.Config{
-		Server:       opts.Server,
-		ClientID:     opts.ClientID,
-		ClientSecret: opts.ClientSecret,
-		AccessToken:  opts.AccessToken,
+	// Serve the HTTP API alongside the bot, sharing its rate-limited conversion. It starts before
+	// the bot so health checks can report that credentials haven't been verified yet
+	var httpDone <-chan error
+	if opts.HTTPListen != "" {
+		listener, err := net.Listen("tcp", opts.HTTPListen)
+		if err != nil {
+			log.Fatalw("Failed to listen for HTTP", "address", opts.HTTPListen, "error", err)
+		}
+		httpDone = serveHTTP(ctx, listener, newHTTPHandler(replyGen, tracker, log), opts.DrainTimeout, log)
 	}
 
 	// Create and start the bot
-	bot, err := NewBot(config, httpClient, log)
+	botOpts := BotOptions{
+		Streaming:    opts.Streaming,
+		DrainTimeout: opts.DrainTimeout,
+		DryRun:       opts.DryRun,
+		Health:       tracker,
+	}
+
+	if opts.DryRun {
+		log.Warn("Dry run, replies will be logged rather than posted")
+	}
+
+	client := mastodon.NewClient(opts.mastodonConfig())
+	client.Transport = metrics.MastodonTransport(client.Transport)
+
+	bot, err := NewBot(ctx, client, replyGen, st, botOpts, log)
 	if err != nil {
 		log.Fatalw("Failed to create bot", "error", err)
 	}
 
-	// Run the bot with a cancellable context
-	ctx := context.Background()
-	bot.Run(ctx, opts.PollInterval)
+	go bot.pruneState(ctx, opts.StateMaxAge)
+	runErr := bot.Run(ctx, opts.PollInterval)
+
+	if httpDone != nil {
+		if err := <-httpDone; err != nil {
+			log.Errorw("HTTP server did not shut down cleanly", "error", err)
+			runErr = errors.Join(runErr, err)
+		}
+	}
+
+	if runErr != nil {
+		log.Errorw("Shutdown did not complete cleanly", "error", runErr)
+		return 1
+	}
+
+	log.Info("Shutdown complete")
+	return 0
 }
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/health"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/mastodon/mastodontest"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply/replytest"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/store"
+	"github.com/mattn/go-mastodon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// alice mentions the bot in the tests
+var alice = &mastodon.Account{ID: "2", Username: "alice", Acct: "alice@example.com"}
+
+const mapsLinkHTML = `<p><span class="h-card"><a href="https://c.im/@gMapsToOSM" class="u-url mention">@<span>gMapsToOSM</span></a></span> meet here <a href="https://www.google.com/maps/@51.558,2.218,15z" rel="nofollow noopener" target="_blank"><span class="invisible">https://www.</span><span class="ellipsis">google.com/maps/@51.558,2.218,</span><span class="invisible">15z</span></a></p>`
+
+// newTestBot creates a bot talking to server which converts links offline, along with its store.
+// Health checks aren't reported unless opts has a tracker
+func newTestBot(t *testing.T, server *mastodontest.Server, opts BotOptions) (*Bot, *store.Store) {
+	t.Helper()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	replyGen := replytest.NewGenerator(t, "osmapp", reply.Options{})
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.db"), logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	bot, err := NewBot(context.Background(), mastodon.NewClient(server.Config()), replyGen, st, opts, logger)
+	require.NoError(t, err)
+	return bot, st
+}
+
+func TestNewBotFailsWithBadCredentials(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	tracker := health.NewTracker(time.Hour)
+
+	client := mastodon.NewClient(&mastodon.Config{Server: server.URL, AccessToken: "wrong"})
+	_, err := NewBot(context.Background(), client, nil, nil, BotOptions{Health: tracker}, zaptest.NewLogger(t).Sugar())
+	assert.Error(t, err)
+	assert.False(t, tracker.Status().CredentialsVerified)
+}
+
+func TestNewBotGivesUpWhenCancelled(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	server.Hold(t, "GET /api/v1/accounts/verify_credentials")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		assert.Eventually(t, func() bool {
+			return server.Requests("GET /api/v1/accounts/verify_credentials") == 1
+		}, 10*time.Second, 10*time.Millisecond)
+	}()
+
+	_, err := NewBot(ctx, mastodon.NewClient(server.Config()), nil, nil, BotOptions{Health: health.NewTracker(time.Hour)}, zaptest.NewLogger(t).Sugar())
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMentionIsRepliedToAndDismissed(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+
+	bot, st := newTestBot(t, server, BotOptions{})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	replies := server.Replies(mention.Status.ID)
+	require.Len(t, replies, 1)
+	assert.Contains(t, replies[0].Content, "https://osmapp.org/51.558,2.218")
+	assert.Equal(t, "public", replies[0].Visibility)
+
+	assert.Equal(t, []mastodon.ID{mention.ID}, server.Dismissed())
+	assert.Empty(t, server.Notifications())
+
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, store.OutcomeReplied, record.Outcome)
+	assert.Equal(t, string(replies[0].ID), record.ReplyID)
+}
+
+func TestMentionInReplyToLinkScansParent(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	parent := server.AddStatus(alice, mapsLinkHTML, "")
+	mention := server.Mention(alice, "<p>@gMapsToOSM what about this one?</p>", parent.ID)
+
+	bot, _ := newTestBot(t, server, BotOptions{})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	replies := server.Replies(mention.Status.ID)
+	require.Len(t, replies, 1)
+	assert.Contains(t, replies[0].Content, "https://osmapp.org/51.558,2.218")
+}
+
+func TestMentionAlreadyRepliedOnServerIsNotRepliedToAgain(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+	server.AddStatus(server.Account, "An earlier reply", mention.Status.ID)
+
+	bot, st := newTestBot(t, server, BotOptions{})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	assert.Len(t, server.Replies(mention.Status.ID), 1)
+	assert.Equal(t, []mastodon.ID{mention.ID}, server.Dismissed())
+
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, store.OutcomeAlreadyReplied, record.Outcome)
+}
+
+func TestMentionRecordedInStoreIsSkipped(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+
+	bot, st := newTestBot(t, server, BotOptions{})
+	require.NoError(t, st.Put(store.Record{StatusID: string(mention.Status.ID), Outcome: store.OutcomeReplied, HandledAt: time.Now()}))
+
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	assert.Empty(t, server.Replies(mention.Status.ID))
+	assert.Zero(t, server.Requests("GET /api/v1/statuses/{id}/context"))
+	assert.Equal(t, []mastodon.ID{mention.ID}, server.Dismissed())
+}
+
+func TestNonMentionNotificationsAreSkipped(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	status := server.AddStatus(server.Account, "A reply", "")
+	favourite := server.Notify(&mastodon.Notification{Type: "favourite", Account: *alice, Status: status})
+
+	bot, _ := newTestBot(t, server, BotOptions{})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	assert.Zero(t, server.Requests("POST /api/v1/statuses"))
+	assert.Empty(t, server.Dismissed())
+	assert.Equal(t, []*mastodon.Notification{favourite}, server.Notifications())
+}
+
+func TestProcessNotificationsFollowsPages(t *testing.T) {
+	server := mastodontest.NewServer(t)
+
+	// More than one page of 20
+	var mentions []*mastodon.Notification
+	for i := range 45 {
+		mentions = append(mentions, server.Mention(alice, fmt.Sprintf(`<p>@gMapsToOSM <a href="https://www.google.com/maps/@51.%d,2.218,15z">here</a></p>`, i+100), ""))
+	}
+
+	bot, _ := newTestBot(t, server, BotOptions{})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	for _, mention := range mentions {
+		assert.Len(t, server.Replies(mention.Status.ID), 1, "mention %s", mention.ID)
+	}
+	assert.Len(t, server.Dismissed(), 45)
+	assert.Empty(t, server.Notifications())
+	assert.GreaterOrEqual(t, server.Requests("GET /api/v1/notifications"), 3)
+}
+
+func TestFailedReplyIsRetriedOnNextPoll(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+	server.Fail("POST /api/v1/statuses", http.StatusInternalServerError)
+
+	bot, st := newTestBot(t, server, BotOptions{})
+
+	// The failure is per mention, so the poll itself still succeeds
+	require.NoError(t, bot.processNotifications(context.Background()))
+	assert.Empty(t, server.Replies(mention.Status.ID))
+	assert.Empty(t, server.Dismissed())
+
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	require.NoError(t, bot.processNotifications(context.Background()))
+	assert.Len(t, server.Replies(mention.Status.ID), 1)
+	assert.Equal(t, []mastodon.ID{mention.ID}, server.Dismissed())
+}
+
+func TestFailedFetchIsReturned(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	server.Mention(alice, mapsLinkHTML, "")
+	server.Fail("GET /api/v1/notifications", http.StatusServiceUnavailable)
+
+	tracker := health.NewTracker(time.Hour)
+	bot, _ := newTestBot(t, server, BotOptions{Health: tracker})
+
+	assert.Error(t, bot.processNotifications(context.Background()))
+	assert.Nil(t, tracker.Status().LastSuccess)
+	assert.Len(t, server.Notifications(), 1)
+
+	require.NoError(t, bot.processNotifications(context.Background()))
+	assert.NotNil(t, tracker.Status().LastSuccess)
+	assert.Empty(t, server.Notifications())
+}
+
+func TestShutdownBeforeFetchingIsNotSuccess(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	server.Mention(alice, mapsLinkHTML, "")
+
+	tracker := health.NewTracker(time.Hour)
+	bot, _ := newTestBot(t, server, BotOptions{Health: tracker})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, bot.processNotifications(ctx))
+	assert.Nil(t, tracker.Status().LastSuccess)
+	assert.Len(t, server.Notifications(), 1)
+}
+
+func TestDryRunDoesNotPostOrDismiss(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+
+	bot, st := newTestBot(t, server, BotOptions{DryRun: true})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	assert.Zero(t, server.Requests("POST /api/v1/statuses"))
+	assert.Empty(t, server.Dismissed())
+
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestDryRunHandlesEachMentionOnce(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	server.Mention(alice, mapsLinkHTML, "")
+
+	bot, _ := newTestBot(t, server, BotOptions{DryRun: true})
+	for range 3 {
+		require.NoError(t, bot.processNotifications(context.Background()))
+	}
+
+	// The notification is fetched by every poll, but only processed the first time
+	assert.Len(t, server.Notifications(), 1)
+	assert.Equal(t, 1, server.Requests("GET /api/v1/statuses/{id}/context"))
+}
+
+func TestDryRunDoesNotRecordAlreadyRepliedInStore(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+	server.AddStatus(server.Account, "Already answered", mention.Status.ID)
+
+	bot, st := newTestBot(t, server, BotOptions{DryRun: true})
+	require.NoError(t, bot.processNotifications(context.Background()))
+
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestDryRunForgetsHandledMentionsWhenPruned(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	server.Mention(alice, mapsLinkHTML, "")
+
+	bot, _ := newTestBot(t, server, BotOptions{DryRun: true})
+	require.NoError(t, bot.processNotifications(context.Background()))
+	require.Len(t, bot.dryRunHandled, 1)
+
+	bot.pruneDryRunHandled(time.Now().Add(-time.Hour))
+	assert.Len(t, bot.dryRunHandled, 1, "Recently handled mentions are kept")
+
+	bot.pruneDryRunHandled(time.Now().Add(time.Hour))
+	assert.Empty(t, bot.dryRunHandled)
+}
+
+func TestRunRepliesUntilCancelled(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+
+	tracker := health.NewTracker(time.Hour)
+	bot, _ := newTestBot(t, server, BotOptions{DrainTimeout: 5 * time.Second, Health: tracker})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- bot.Run(ctx, time.Hour)
+	}()
+
+	// Mentions are handled as soon as the bot starts
+	require.Eventually(t, func() bool {
+		return len(server.Replies(mention.Status.ID)) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't return after cancellation")
+	}
+
+	status := tracker.Status()
+	assert.True(t, status.Ready)
+	assert.Equal(t, "1h0m0s", status.PollInterval)
+}
+
+func TestRunReturnsDrainTimeoutWhenReplyHangs(t *testing.T) {
+	server := mastodontest.NewServer(t)
+	mention := server.Mention(alice, mapsLinkHTML, "")
+	server.Hold(t, "POST /api/v1/statuses")
+
+	bot, st := newTestBot(t, server, BotOptions{DrainTimeout: 100 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- bot.Run(ctx, time.Hour)
+	}()
+
+	// Shut down while the reply is being posted
+	require.Eventually(t, func() bool {
+		return server.Requests("POST /api/v1/statuses") == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-runErr:
+		assert.ErrorIs(t, err, errDrainTimeout)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't return after the drain timeout")
+	}
+
+	// The mention is left to be handled after a restart
+	record, err := st.Get(string(mention.Status.ID))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+	assert.Empty(t, server.Dismissed())
+	assert.Len(t, server.Notifications(), 1)
+}
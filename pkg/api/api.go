@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"go.uber.org/zap"
+)
+
+// maxRequestBytes caps request bodies, conversion requests are only ever a few links
+const maxRequestBytes = 64 << 10
+
+// MaxURLs is the most map links converted per request, as each may take several
+// rate-limited requests to resolve and the rate limit is shared with the bot
+const MaxURLs = 10
+
+// ConvertRequest is the JSON body of POST /v1/convert. Map links are found in Text the
+// same way as in statuses, while every entry in URLs must be a link to a supported map service
+type ConvertRequest struct {
+	Text string   `json:"text,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+}
+
+// ConvertResponse is the response to POST /v1/convert
+type ConvertResponse struct {
+	// Results has an entry for every map link in the request, in order
+	Results []reply.ConversionResult `json:"results"`
+
+	// Reply is what the bot would reply to a status containing the URLs
+	Reply string `json:"reply"`
+}
+
+// errorResponse is returned for requests which can't be handled
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the conversion API
+type Handler struct {
+	generator *reply.Generator
+	mux       *http.ServeMux
+	logger    *zap.SugaredLogger
+}
+
+// NewHandler creates a new API handler which converts links with generator
+func NewHandler(generator *reply.Generator, logger *zap.SugaredLogger) *Handler {
+	h := &Handler{
+		generator: generator,
+		mux:       http.NewServeMux(),
+		logger:    logger,
+	}
+
+	h.mux.HandleFunc("POST /v1/convert", h.convert)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// convert handles POST /v1/convert. Bodies are JSON ConvertRequests, or plain text to scan for links
+func (h *Handler) convert(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	req, err := decodeConvertRequest(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body larger than %d bytes", maxRequestBytes))
+			return
+		}
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mapURLs, err := req.mapURLs()
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(mapURLs) > MaxURLs {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("too many map links, at most %d can be converted per request", MaxURLs))
+		return
+	}
+
+	response := ConvertResponse{Results: []reply.ConversionResult{}}
+	if len(mapURLs) == 0 {
+		response.Reply = reply.NoLinksReply
+	} else {
+		h.logger.Infow("Converting URLs for API request", "count", len(mapURLs), "remoteAddr", r.RemoteAddr)
+		response.Results = h.generator.Convert(r.Context(), mapURLs)
+		response.Reply = reply.FormatReply(response.Results)
+	}
+
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// decodeConvertRequest reads a ConvertRequest from a JSON or plain text body
+func decodeConvertRequest(body io.Reader, contentType string) (*ConvertRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "text/plain" {
+		text, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return &ConvertRequest{Text: string(text)}, nil
+	}
+
+	var req ConvertRequest
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return &req, nil
+}
+
+// mapURLs returns the map links in the request, without duplicates
+func (req *ConvertRequest) mapURLs() ([]string, error) {
+	for _, u := range req.URLs {
+		if !gmaps.IsMapURL(u) {
+			return nil, fmt.Errorf("not a link to a supported map service: %q", u)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	for _, u := range slices.Concat(req.URLs, gmaps.ExtractMapURLs(req.Text)) {
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+
+	return urls, nil
+}
+
+// writeError writes an error response with the given status code
+func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+	h.logger.Debugw("Rejecting API request", "status", status, "error", message)
+	h.writeJSON(w, status, errorResponse{Error: message})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Warnw("Failed to write API response", "error", err)
+	}
+}
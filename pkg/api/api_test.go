@@ -0,0 +1,173 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/api"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply/replytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// convertResponse mirrors api.ConvertResponse with the error messages that are marshalled in place of errors
+type convertResponse struct {
+	Results []struct {
+		OriginalURL string             `json:"original_url"`
+		Coordinates *gmaps.Coordinates `json:"coordinates"`
+		Links       []reply.Link       `json:"links"`
+		Error       string             `json:"error"`
+	} `json:"results"`
+	Reply string `json:"reply"`
+	Error string `json:"error"`
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	logger := zaptest.NewLogger(t).Sugar()
+	generator := replytest.NewGenerator(t, "osmapp", reply.Options{})
+
+	server := httptest.NewServer(api.NewHandler(generator, logger))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// manyURLs returns text containing n distinct map links
+func manyURLs(n int) string {
+	var sb strings.Builder
+	for i := range n {
+		fmt.Fprintf(&sb, "https://www.google.com/maps/@%d,0,15z ", i)
+	}
+	return sb.String()
+}
+
+func TestConvert(t *testing.T) {
+	server := newTestServer(t)
+
+	testCases := []struct {
+		name          string
+		contentType   string
+		body          string
+		expectStatus  int
+		expectURLs    []string
+		expectErrors  []bool
+		expectReply   string
+		errorContains string
+	}{
+		{
+			name:         "URLs",
+			contentType:  "application/json",
+			body:         `{"urls": ["https://www.google.com/maps/@51.558,2.218,15z", "https://www.google.com/maps/search/restaurants"]}`,
+			expectStatus: http.StatusOK,
+			expectURLs:   []string{"https://www.google.com/maps/@51.558,2.218,15z", "https://www.google.com/maps/search/restaurants"},
+			expectErrors: []bool{false, true},
+			expectReply: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Google Maps link https://www.google.com/maps/@51.558,2.218,15z to https://osmapp.org/51.558,2.218\n\n" +
+				"Couldn't convert Google Maps link https://www.google.com/maps/search/restaurants",
+		},
+		{
+			name:         "Text and URLs are combined without duplicates",
+			contentType:  "application/json",
+			body:         `{"urls": ["https://maps.google.com/maps?q=51.5074,-0.1278"], "text": "here https://maps.google.com/maps?q=51.5074,-0.1278 or https://www.google.com/maps/@0,0,19z"}`,
+			expectStatus: http.StatusOK,
+			expectURLs:   []string{"https://maps.google.com/maps?q=51.5074,-0.1278", "https://www.google.com/maps/@0,0,19z"},
+			expectErrors: []bool{false, false},
+		},
+		{
+			name:         "Plain text body",
+			contentType:  "text/plain; charset=utf-8",
+			body:         "Meet at https://www.google.com/maps/@51.558,2.218,15z",
+			expectStatus: http.StatusOK,
+			expectURLs:   []string{"https://www.google.com/maps/@51.558,2.218,15z"},
+			expectErrors: []bool{false},
+		},
+		{
+			name:         "No links",
+			contentType:  "application/json",
+			body:         `{"text": "hello"}`,
+			expectStatus: http.StatusOK,
+			expectURLs:   []string{},
+			expectReply:  "No map links found",
+		},
+		{
+			name:          "Not a map link",
+			contentType:   "application/json",
+			body:          `{"urls": ["https://example.com/maps/@51.558,2.218,15z"]}`,
+			expectStatus:  http.StatusBadRequest,
+			errorContains: "not a link to a supported map service",
+		},
+		{
+			name:          "Invalid JSON",
+			contentType:   "application/json",
+			body:          `{"urls": "https://www.google.com/maps/@51.558,2.218,15z"}`,
+			expectStatus:  http.StatusBadRequest,
+			errorContains: "invalid request body",
+		},
+		{
+			name:          "Unknown field",
+			contentType:   "application/json",
+			body:          `{"url": "https://www.google.com/maps/@51.558,2.218,15z"}`,
+			expectStatus:  http.StatusBadRequest,
+			errorContains: "unknown field",
+		},
+		{
+			name:          "Too many URLs",
+			contentType:   "text/plain",
+			body:          manyURLs(api.MaxURLs + 1),
+			expectStatus:  http.StatusBadRequest,
+			errorContains: "too many map links",
+		},
+		{
+			name:          "Body too large",
+			contentType:   "text/plain",
+			body:          strings.Repeat("a", 1<<20),
+			expectStatus:  http.StatusRequestEntityTooLarge,
+			errorContains: "request body larger than",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/v1/convert", tc.contentType, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectStatus, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			var body convertResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+			if tc.errorContains != "" {
+				assert.Contains(t, body.Error, tc.errorContains)
+				return
+			}
+
+			require.Len(t, body.Results, len(tc.expectURLs))
+			for i, result := range body.Results {
+				assert.Equal(t, tc.expectURLs[i], result.OriginalURL)
+				assert.Equal(t, tc.expectErrors[i], result.Error != "", "Error for %s", result.OriginalURL)
+				assert.Equal(t, tc.expectErrors[i], result.Coordinates == nil, "Coordinates for %s", result.OriginalURL)
+			}
+			if tc.expectReply != "" {
+				assert.Equal(t, tc.expectReply, body.Reply)
+			}
+		})
+	}
+}
+
+func TestConvertRejectsOtherMethods(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/v1/convert")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,221 @@
+package gmaps
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// CacheBackend persists resolved links beyond the in-memory cache, e.g. in the bot's state file.
+// Values are opaque to the backend
+type CacheBackend interface {
+	// GetResolution returns the value stored for url and when it expires, or nil if there is none
+	GetResolution(url string) ([]byte, time.Time, error)
+
+	// PutResolution stores value for url until expiresAt
+	PutResolution(url string, value []byte, expiresAt time.Time) error
+}
+
+// CacheOptions configures a ResolutionCache
+type CacheOptions struct {
+	// Size is how many resolutions are kept in memory, least recently used are evicted first
+	Size int
+
+	// TTL is how long successful resolutions are kept
+	TTL time.Duration
+
+	// NegativeTTL is how long links which don't lead to coordinates are remembered, so they
+	// aren't fetched again for every mention while still being retried eventually. Failures
+	// that may be temporary, like throttling, aren't remembered
+	NegativeTTL time.Duration
+}
+
+// resolution is a cached result of following a link
+type resolution struct {
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+	Pattern     string       `json:"pattern,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	ExpiresAt   time.Time    `json:"-"`
+}
+
+// cacheItem is an entry in the LRU list
+type cacheItem struct {
+	url        string
+	resolution resolution
+}
+
+// ResolutionCache remembers what links resolved to, so links shared again aren't fetched again.
+// It is safe for concurrent use
+type ResolutionCache struct {
+	opts   CacheOptions
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List
+	backend CacheBackend
+}
+
+// NewResolutionCache creates an in-memory cache. Use Persist to also keep resolutions on disk
+func NewResolutionCache(opts CacheOptions, logger *zap.SugaredLogger) *ResolutionCache {
+	return &ResolutionCache{
+		opts:   opts,
+		logger: logger,
+		items:  make(map[string]*list.Element),
+		lru:    list.New(),
+	}
+}
+
+// Persist stores resolutions in backend as well as in memory, and looks up resolutions there
+// when they aren't in memory
+func (c *ResolutionCache) Persist(backend CacheBackend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backend = backend
+}
+
+// get returns the cached resolution of url, if there is one which hasn't expired
+func (c *ResolutionCache) get(url string) (resolution, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if elem, ok := c.items[url]; ok {
+		item := elem.Value.(*cacheItem)
+		if now.Before(item.resolution.ExpiresAt) {
+			c.lru.MoveToFront(elem)
+			return item.resolution.clone(), true
+		}
+		c.remove(elem)
+	}
+
+	if c.backend == nil {
+		return resolution{}, false
+	}
+
+	value, expiresAt, err := c.backend.GetResolution(url)
+	if err != nil {
+		c.logger.Warnw("Failed to read cached resolution", "url", url, "error", err)
+		return resolution{}, false
+	}
+	if value == nil || !now.Before(expiresAt) {
+		return resolution{}, false
+	}
+
+	var res resolution
+	if err := json.Unmarshal(value, &res); err != nil {
+		c.logger.Warnw("Ignoring unreadable cached resolution", "url", url, "error", err)
+		return resolution{}, false
+	}
+	res.ExpiresAt = expiresAt
+
+	c.add(url, res)
+	return res.clone(), true
+}
+
+// put caches the result of resolving url, for the negative TTL if err is set
+func (c *ResolutionCache) put(url string, coords *Coordinates, pattern string, err error) {
+	res := resolution{ExpiresAt: time.Now().Add(c.opts.TTL)}
+	if err != nil {
+		res.Error = err.Error()
+		res.ExpiresAt = time.Now().Add(c.opts.NegativeTTL)
+	} else {
+		res.Coordinates = coords
+		res.Pattern = pattern
+	}
+	res = res.clone()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(url, res)
+
+	if c.backend == nil {
+		return
+	}
+
+	value, marshalErr := json.Marshal(res)
+	if marshalErr == nil {
+		marshalErr = c.backend.PutResolution(url, value, res.ExpiresAt)
+	}
+	if marshalErr != nil {
+		c.logger.Warnw("Failed to persist cached resolution", "url", url, "error", marshalErr)
+	}
+}
+
+// add stores res in memory, evicting the least recently used entries if the cache is full. c.mu must be held
+func (c *ResolutionCache) add(url string, res resolution) {
+	if elem, ok := c.items[url]; ok {
+		elem.Value.(*cacheItem).resolution = res
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[url] = c.lru.PushFront(&cacheItem{url: url, resolution: res})
+	for c.lru.Len() > c.opts.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops elem from memory. c.mu must be held
+func (c *ResolutionCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.items, elem.Value.(*cacheItem).url)
+}
+
+// clone copies the coordinates and their route, so callers can't modify the cached ones
+func (r resolution) clone() resolution {
+	if r.Coordinates != nil {
+		coords := *r.Coordinates
+		if coords.Route != nil {
+			route := *coords.Route
+			route.Waypoints = slices.Clone(route.Waypoints)
+			coords.Route = &route
+		}
+		r.Coordinates = &coords
+	}
+	return r
+}
+
+// cachedFailure is a failure to resolve a link read back from the cache, where only
+// ErrNoCoordinates failures are kept
+type cachedFailure string
+
+func (f cachedFailure) Error() string { return string(f) }
+
+func (f cachedFailure) Unwrap() error { return ErrNoCoordinates }
+
+// cachedExtractByFollowingURL wraps extractByFollowingURL with the cache, if there is one
+func (e *Extractor) cachedExtractByFollowingURL(ctx context.Context, urlStr string) (*Coordinates, string, error) {
+	if e.cache == nil {
+		return e.extractByFollowingURL(ctx, urlStr)
+	}
+
+	if res, ok := e.cache.get(urlStr); ok {
+		if res.Error != "" {
+			metrics.ResolutionCacheLookups.WithLabelValues("negative_hit").Inc()
+			e.logger.Debugw("Using cached failure to resolve URL", "url", urlStr, "error", res.Error)
+			return nil, "", cachedFailure(res.Error)
+		}
+		metrics.ResolutionCacheLookups.WithLabelValues("hit").Inc()
+		e.logger.Debugw("Using cached resolution of URL", "url", urlStr, "coords", res.Coordinates)
+		return res.Coordinates, res.Pattern, nil
+	}
+	metrics.ResolutionCacheLookups.WithLabelValues("miss").Inc()
+
+	coords, pattern, err := e.extractByFollowingURL(ctx, urlStr)
+
+	// Only remember failures that trying again won't fix, not throttling, network errors or shutting down
+	if err == nil || errors.Is(err, ErrNoCoordinates) {
+		e.cache.put(urlStr, coords, pattern, err)
+	}
+
+	return coords, pattern, err
+}
@@ -0,0 +1,229 @@
+package gmaps_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// countingRedirectHTTPClient redirects short links like mockRedirectHTTPClient, counting the requests for each.
+// Links in statuses get that status instead, and links in failures fail with that error
+type countingRedirectHTTPClient struct {
+	redirectMap map[string]string
+	statuses    map[string]int
+	failures    map[string]error
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (m *countingRedirectHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	if m.requests == nil {
+		m.requests = map[string]int{}
+	}
+	m.requests[req.URL.String()]++
+	m.mu.Unlock()
+
+	if err, ok := m.failures[req.URL.String()]; ok {
+		return nil, err
+	}
+	if status, ok := m.statuses[req.URL.String()]; ok {
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString("")), Request: req}, nil
+	}
+
+	locationURL, ok := m.redirectMap[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString("")), Request: req}, nil
+	}
+
+	header := http.Header{}
+	header.Set("Location", locationURL)
+	return &http.Response{StatusCode: http.StatusFound, Header: header, Body: io.NopCloser(bytes.NewBufferString("")), Request: req}, nil
+}
+
+func (m *countingRedirectHTTPClient) count(url string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests[url]
+}
+
+// memoryBackend is a CacheBackend kept in a map, standing in for the state file
+type memoryBackend struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	expiry map[string]time.Time
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{values: map[string][]byte{}, expiry: map[string]time.Time{}}
+}
+
+func (b *memoryBackend) GetResolution(url string) ([]byte, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[url], b.expiry[url], nil
+}
+
+func (b *memoryBackend) PutResolution(url string, value []byte, expiresAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[url] = value
+	b.expiry[url] = expiresAt
+	return nil
+}
+
+const (
+	shortLinkA = "https://maps.app.goo.gl/aaaaaaaaaaaaaaaaa"
+	shortLinkB = "https://maps.app.goo.gl/bbbbbbbbbbbbbbbbb"
+	shortLinkC = "https://maps.app.goo.gl/ccccccccccccccccc"
+	brokenLink = "https://maps.app.goo.gl/brokenbrokenbroke"
+)
+
+func newCachingExtractor(t *testing.T, opts gmaps.CacheOptions) (*gmaps.Extractor, *gmaps.ResolutionCache, *countingRedirectHTTPClient) {
+	t.Helper()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	client := &countingRedirectHTTPClient{redirectMap: map[string]string{
+		shortLinkA: "https://www.google.com/maps/search/20.533907,+27.158833",
+		shortLinkB: "https://www.google.com/maps/search/51.5,+-0.12",
+		shortLinkC: "https://www.google.com/maps/search/-33.8688,+151.2093",
+	}}
+
+	cache := gmaps.NewResolutionCache(opts, logger)
+	extractor := gmaps.NewExtractor(client, 5, logger)
+	extractor.SetCache(cache)
+	return extractor, cache, client
+}
+
+func TestResolutionCacheRemembersResolutions(t *testing.T) {
+	extractor, _, client := newCachingExtractor(t, gmaps.CacheOptions{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour})
+
+	for range 3 {
+		coords, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+		require.NoError(t, err)
+		assert.InDelta(t, 20.533907, coords.Latitude, 0.0001)
+
+		// Changes by the caller don't leak into the cache
+		coords.Latitude = 0
+	}
+	assert.Equal(t, 1, client.count(shortLinkA))
+}
+
+func TestResolutionCacheRemembersFailures(t *testing.T) {
+	extractor, _, client := newCachingExtractor(t, gmaps.CacheOptions{Size: 10, TTL: time.Hour, NegativeTTL: 50 * time.Millisecond})
+
+	_, err := extractor.ExtractCoordinates(context.Background(), brokenLink)
+	require.Error(t, err)
+	_, cachedErr := extractor.ExtractCoordinates(context.Background(), brokenLink)
+	require.Error(t, cachedErr)
+	assert.Equal(t, err.Error(), cachedErr.Error())
+	assert.ErrorIs(t, cachedErr, gmaps.ErrNoCoordinates)
+	assert.Equal(t, 1, client.count(brokenLink))
+
+	// Failures are tried again once the negative TTL has passed
+	time.Sleep(100 * time.Millisecond)
+	_, err = extractor.ExtractCoordinates(context.Background(), brokenLink)
+	require.Error(t, err)
+	assert.Equal(t, 2, client.count(brokenLink))
+}
+
+func TestResolutionCacheForgetsTemporaryFailures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		failure  error
+		expected error
+	}{
+		{name: "Too many requests", status: http.StatusTooManyRequests, expected: gmaps.ErrThrottled},
+		{name: "Service unavailable", status: http.StatusServiceUnavailable, expected: gmaps.ErrThrottled},
+		{name: "Server error", status: http.StatusBadGateway},
+		{name: "Network failure", failure: errors.New("i/o timeout")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			extractor, _, client := newCachingExtractor(t, gmaps.CacheOptions{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour})
+			if tc.failure != nil {
+				client.failures = map[string]error{shortLinkA: tc.failure}
+			} else {
+				client.statuses = map[string]int{shortLinkA: tc.status}
+			}
+
+			_, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, gmaps.ErrNoCoordinates)
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+			}
+
+			// Once the link works again it resolves straight away
+			client.statuses, client.failures = nil, nil
+			coords, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+			require.NoError(t, err)
+			assert.InDelta(t, 20.533907, coords.Latitude, 0.0001)
+			assert.Equal(t, 2, client.count(shortLinkA))
+		})
+	}
+}
+
+func TestResolutionCacheExpires(t *testing.T) {
+	extractor, _, client := newCachingExtractor(t, gmaps.CacheOptions{Size: 10, TTL: 50 * time.Millisecond, NegativeTTL: time.Hour})
+
+	_, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = extractor.ExtractCoordinates(context.Background(), shortLinkA)
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.count(shortLinkA))
+}
+
+func TestResolutionCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	extractor, _, client := newCachingExtractor(t, gmaps.CacheOptions{Size: 2, TTL: time.Hour, NegativeTTL: time.Hour})
+	ctx := context.Background()
+
+	for _, link := range []string{shortLinkA, shortLinkB, shortLinkA, shortLinkC} {
+		_, err := extractor.ExtractCoordinates(ctx, link)
+		require.NoError(t, err)
+	}
+
+	// B was least recently used when C was added, so only it has to be fetched again
+	for _, link := range []string{shortLinkA, shortLinkB} {
+		_, err := extractor.ExtractCoordinates(ctx, link)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, client.count(shortLinkA))
+	assert.Equal(t, 2, client.count(shortLinkB))
+	assert.Equal(t, 1, client.count(shortLinkC))
+}
+
+func TestResolutionCachePersists(t *testing.T) {
+	backend := newMemoryBackend()
+	opts := gmaps.CacheOptions{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}
+
+	extractor, cache, client := newCachingExtractor(t, opts)
+	cache.Persist(backend)
+	_, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+	require.NoError(t, err)
+	require.Equal(t, 1, client.count(shortLinkA))
+
+	// A new cache, as if the bot had restarted, finds the resolution in the backend
+	extractor, cache, client = newCachingExtractor(t, opts)
+	cache.Persist(backend)
+	coords, err := extractor.ExtractCoordinates(context.Background(), shortLinkA)
+	require.NoError(t, err)
+	assert.InDelta(t, 20.533907, coords.Latitude, 0.0001)
+	assert.InDelta(t, 27.158833, coords.Longitude, 0.0001)
+	assert.Zero(t, client.count(shortLinkA))
+}
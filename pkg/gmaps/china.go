@@ -0,0 +1,87 @@
+package gmaps
+
+// point is a longitude/latitude vertex of a boundary polygon
+type point struct {
+	lon float64
+	lat float64
+}
+
+// mainlandChina is a coarse outline of mainland China, accurate to a few tens of kilometres along
+// land borders and coasts. Hainan is included, Taiwan lies outside it
+var mainlandChina = []point{
+	// Northwest and northern land borders
+	{73.6, 39.45}, {75.7, 40.3}, {76.9, 41.1}, {78.4, 41.4}, {80.2, 42.2}, {80.1, 42.9}, {80.8, 43.2},
+	{80.4, 44.9}, {82.5, 45.2}, {83.0, 47.2}, {85.5, 47.1}, {85.8, 48.4}, {87.3, 49.1}, {88.9, 48.1},
+	{91.0, 46.6}, {90.6, 45.6}, {93.5, 45.0}, {95.4, 44.3}, {96.4, 42.7}, {100.8, 42.7}, {105.0, 41.6},
+	{107.0, 42.4}, {110.4, 42.8}, {111.9, 43.7}, {111.4, 44.4}, {113.6, 44.8}, {117.4, 46.6},
+	{119.9, 46.7}, {118.6, 47.9}, {115.6, 47.9}, {116.7, 49.85},
+
+	// Northeastern borders with Russia and North Korea
+	{120.8, 53.3}, {123.4, 53.5}, {125.6, 53.1}, {126.6, 51.9}, {127.5, 50.2}, {130.6, 48.9},
+	{132.6, 47.8}, {134.7, 48.3}, {134.1, 47.3}, {133.1, 45.1}, {131.9, 45.3}, {131.0, 44.9},
+	{131.3, 43.4}, {131.0, 42.9}, {130.6, 42.4}, {129.9, 43.0}, {128.9, 42.0}, {128.0, 41.5},
+	{126.6, 41.7}, {125.3, 40.5}, {124.3, 39.9},
+
+	// East coast
+	{122.3, 39.4}, {121.1, 38.7}, {122.2, 40.7}, {121.1, 40.8}, {119.6, 39.9}, {117.7, 38.9},
+	{117.6, 38.3}, {119.2, 37.8}, {120.7, 37.8}, {122.7, 37.4}, {122.4, 36.9}, {120.7, 36.1},
+	{119.3, 35.1}, {119.4, 34.7}, {120.3, 33.5}, {120.9, 32.6}, {121.9, 31.7}, {122.0, 30.9},
+	{122.5, 30.0}, {121.9, 29.0}, {121.6, 28.3}, {120.8, 27.6}, {120.3, 26.9}, {119.8, 26.2},
+	{119.9, 25.5}, {119.1, 25.0}, {118.7, 24.6}, {118.3, 24.4}, {117.6, 23.8}, {116.8, 23.2},
+
+	// South coast and Hainan
+	{115.6, 22.7}, {114.6, 22.3}, {113.9, 22.1}, {113.3, 21.9}, {112.3, 21.6}, {111.2, 21.4},
+	{111.1, 19.6}, {110.2, 18.1}, {109.4, 18.1}, {108.5, 18.6}, {108.6, 19.4}, {109.6, 20.6},
+	{109.1, 21.4}, {108.0, 21.5},
+
+	// Southern and southwestern land borders
+	{106.7, 22.0}, {106.6, 22.9}, {105.3, 23.3}, {104.0, 22.7}, {103.0, 22.5}, {102.1, 22.4},
+	{101.6, 21.2}, {100.1, 21.6}, {99.2, 22.1}, {99.5, 22.9}, {98.9, 23.2}, {97.7, 23.9},
+	{97.5, 24.8}, {98.1, 25.4}, {98.7, 25.9}, {98.7, 27.5}, {97.4, 28.3}, {96.0, 29.4},
+	{94.6, 29.2}, {92.0, 27.9}, {90.3, 28.3}, {88.9, 27.4}, {88.1, 27.9}, {86.0, 28.0},
+	{84.0, 28.9}, {82.0, 30.3}, {81.0, 30.2}, {79.0, 31.3}, {78.8, 32.5}, {78.3, 33.9},
+	{78.0, 35.5}, {76.0, 35.8}, {75.0, 37.0}, {74.8, 38.6},
+}
+
+// notMainlandChina are areas inside the mainlandChina outline where Google Maps uses WGS-84
+var notMainlandChina = [][]point{
+	// Hong Kong, following the Shenzhen River and Deep Bay so Shenzhen stays outside
+	{{113.82, 22.14}, {114.45, 22.14}, {114.45, 22.44}, {114.26, 22.56}, {114.15, 22.535}, {114.03, 22.51}, {113.93, 22.45}, {113.82, 22.40}},
+
+	// Macau
+	{{113.52, 22.10}, {113.60, 22.10}, {113.60, 22.22}, {113.52, 22.22}},
+
+	// Kinmen
+	{{118.22, 24.37}, {118.50, 24.37}, {118.50, 24.53}, {118.22, 24.53}},
+}
+
+// InMainlandChina reports whether the point lies in mainland China, where Google Maps
+// street map coordinates use the GCJ-02 datum
+func InMainlandChina(latitude float64, longitude float64) bool {
+	if !inPolygon(mainlandChina, latitude, longitude) {
+		return false
+	}
+
+	for _, area := range notMainlandChina {
+		if inPolygon(area, latitude, longitude) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inPolygon tests whether the point is inside the polygon using ray casting
+func inPolygon(polygon []point, latitude float64, longitude float64) bool {
+	inside := false
+
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.lat > latitude) != (b.lat > latitude) &&
+			longitude < (b.lon-a.lon)*(latitude-a.lat)/(b.lat-a.lat)+a.lon {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,50 @@
+package gmaps
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Google hosts that can serve interstitial pages under /sorry/
+var googleHostRegex = regexp.MustCompile(`^(?:www\.|maps\.)?google\.(?:com|[a-z]{2}(?:\.[a-z]{2})?)$`)
+
+// Interstitials can wrap each other, but never legitimately this deeply
+const maxInterstitialDepth = 5
+
+// isInterstitial reports whether u is a consent or similar interstitial page that
+// carries the real destination in its continue parameter
+func isInterstitial(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+
+	// EU cookie consent, e.g. consent.google.com or consent.google.co.uk
+	if strings.HasPrefix(host, "consent.google.") {
+		return true
+	}
+
+	// Unusual traffic checks
+	if googleHostRegex.MatchString(host) && strings.HasPrefix(u.Path, "/sorry/") {
+		return true
+	}
+
+	return false
+}
+
+// unwrapInterstitial returns the destination an interstitial page would continue to,
+// unwrapping nested interstitials. It returns false if u isn't an interstitial or
+// has no usable continue parameter
+func unwrapInterstitial(u *url.URL) (*url.URL, bool) {
+	unwrapped := false
+
+	for depth := 0; depth < maxInterstitialDepth && isInterstitial(u); depth++ {
+		next, err := url.Parse(u.Query().Get("continue"))
+		if err != nil || !next.IsAbs() || (next.Scheme != "http" && next.Scheme != "https") {
+			break
+		}
+
+		u = next
+		unwrapped = true
+	}
+
+	return u, unwrapped
+}
@@ -0,0 +1,140 @@
+package gmaps
+
+import (
+	"fmt"
+	"math"
+)
+
+// Datum is the geodetic datum coordinates are expressed in
+type Datum int
+
+const (
+	// WGS84 is the datum used by GPS and OpenStreetMap
+	WGS84 Datum = iota
+
+	// GCJ02 is the obfuscated datum Chinese regulations require street maps of mainland China to use
+	GCJ02
+)
+
+// String returns the conventional name of the datum
+func (d Datum) String() string {
+	switch d {
+	case WGS84:
+		return "WGS-84"
+	case GCJ02:
+		return "GCJ-02"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the datum by its conventional name
+func (d Datum) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a datum from its conventional name
+func (d *Datum) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "WGS-84":
+		*d = WGS84
+	case "GCJ-02":
+		*d = GCJ02
+	default:
+		return fmt.Errorf("unknown datum %q", text)
+	}
+	return nil
+}
+
+// Parameters of the Krasovsky 1940 ellipsoid used by the GCJ-02 transform
+const (
+	krasovskySemiMajorAxis = 6378245.0
+	krasovskyEccentricity2 = 0.00669342162296594323
+)
+
+// GCJ-02 offsets are a few hundred metres, so this converges within a handful of iterations
+const (
+	gcj02MaxIterations = 10
+	gcj02Tolerance     = 1e-9
+)
+
+// HasGCJ02 reports whether the coordinates, or any waypoint of their route, are in GCJ-02
+func (c Coordinates) HasGCJ02() bool {
+	if c.Datum == GCJ02 {
+		return true
+	}
+	if c.Route != nil {
+		for _, waypoint := range c.Route.Waypoints {
+			if waypoint.HasGCJ02() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ToWGS84 returns the coordinates, and the waypoints of their route, converted to WGS-84.
+// Coordinates already in WGS-84 are returned unchanged
+func (c Coordinates) ToWGS84() Coordinates {
+	if c.Route != nil {
+		route := *c.Route
+		route.Waypoints = make([]Coordinates, len(c.Route.Waypoints))
+		for i, waypoint := range c.Route.Waypoints {
+			route.Waypoints[i] = waypoint.ToWGS84()
+		}
+		c.Route = &route
+	}
+
+	if c.Datum != GCJ02 {
+		return c
+	}
+
+	// There's no closed form inverse, so refine a guess until it transforms onto the GCJ-02 point
+	lat, lon := c.Latitude, c.Longitude
+	for i := 0; i < gcj02MaxIterations; i++ {
+		gcjLat, gcjLon := wgs84ToGCJ02(lat, lon)
+		dLat, dLon := gcjLat-c.Latitude, gcjLon-c.Longitude
+		lat, lon = lat-dLat, lon-dLon
+		if math.Abs(dLat) < gcj02Tolerance && math.Abs(dLon) < gcj02Tolerance {
+			break
+		}
+	}
+
+	// Round away floating point noise, 7 decimal places is about a centimetre
+	c.Latitude = math.Round(lat*1e7) / 1e7
+	c.Longitude = math.Round(lon*1e7) / 1e7
+	c.Datum = WGS84
+	return c
+}
+
+// wgs84ToGCJ02 applies the published GCJ-02 obfuscation to a WGS-84 point
+func wgs84ToGCJ02(lat float64, lon float64) (float64, float64) {
+	dLat := gcj02TransformLat(lon-105, lat-35)
+	dLon := gcj02TransformLon(lon-105, lat-35)
+
+	radLat := lat / 180 * math.Pi
+	magic := math.Sin(radLat)
+	magic = 1 - krasovskyEccentricity2*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+
+	dLat = (dLat * 180) / ((krasovskySemiMajorAxis * (1 - krasovskyEccentricity2)) / (magic * sqrtMagic) * math.Pi)
+	dLon = (dLon * 180) / (krasovskySemiMajorAxis / sqrtMagic * math.Cos(radLat) * math.Pi)
+
+	return lat + dLat, lon + dLon
+}
+
+func gcj02TransformLat(x float64, y float64) float64 {
+	ret := -100 + 2*x + 3*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(y*math.Pi) + 40*math.Sin(y/3*math.Pi)) * 2 / 3
+	ret += (160*math.Sin(y/12*math.Pi) + 320*math.Sin(y*math.Pi/30)) * 2 / 3
+	return ret
+}
+
+func gcj02TransformLon(x float64, y float64) float64 {
+	ret := 300 + x + 2*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(x*math.Pi) + 40*math.Sin(x/3*math.Pi)) * 2 / 3
+	ret += (150*math.Sin(x/12*math.Pi) + 300*math.Sin(x/30*math.Pi)) * 2 / 3
+	return ret
+}
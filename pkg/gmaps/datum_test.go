@@ -0,0 +1,76 @@
+package gmaps_test
+
+import (
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMainlandChina(t *testing.T) {
+	testCases := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		expected  bool
+	}{
+		{"Beijing", 39.9042, 116.4074, true},
+		{"Shanghai", 31.2304, 121.4737, true},
+		{"Shenzhen", 22.5431, 114.0579, true},
+		{"Xiamen", 24.4798, 118.0894, true},
+		{"Dandong", 40.1290, 124.3540, true},
+		{"Harbin", 45.8038, 126.5349, true},
+		{"Urumqi", 43.8256, 87.6168, true},
+		{"Kashgar", 39.4704, 75.9898, true},
+		{"Lhasa", 29.6520, 91.1721, true},
+		{"Sanya", 18.2528, 109.5120, true},
+		{"Hong Kong", 22.2819, 114.1582, false},
+		{"Hong Kong New Territories", 22.4450, 114.0220, false},
+		{"Macau", 22.1987, 113.5439, false},
+		{"Taipei", 25.0330, 121.5654, false},
+		{"Kinmen", 24.4367, 118.3189, false},
+		{"Ulaanbaatar", 47.8864, 106.9057, false},
+		{"Pyongyang", 39.0392, 125.7625, false},
+		{"Vladivostok", 43.1155, 131.8855, false},
+		{"Hanoi", 21.0278, 105.8342, false},
+		{"Seoul", 37.5665, 126.9780, false},
+		{"London", 51.5074, -0.1278, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, gmaps.InMainlandChina(tc.latitude, tc.longitude))
+		})
+	}
+}
+
+func TestToWGS84(t *testing.T) {
+	testCases := []struct {
+		name      string
+		gcjLat    float64
+		gcjLon    float64
+		expectLat float64
+		expectLon float64
+	}{
+		{"Shanghai", 31.17530398364597, 121.531541859215, 31.1774276, 121.5272106},
+		{"Shenzhen", 22.540796131694766, 113.9171764808363, 22.543847, 113.912316},
+		{"Beijing", 39.91334545536069, 116.38404722455657, 39.911954, 116.377817},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			coords := gmaps.Coordinates{Latitude: tc.gcjLat, Longitude: tc.gcjLon, Zoom: 15, Datum: gmaps.GCJ02}
+			converted := coords.ToWGS84()
+
+			assert.InDelta(t, tc.expectLat, converted.Latitude, 1e-7, "Latitude should match")
+			assert.InDelta(t, tc.expectLon, converted.Longitude, 1e-7, "Longitude should match")
+			assert.Equal(t, gmaps.WGS84, converted.Datum)
+			assert.Equal(t, 15, converted.Zoom, "Zoom should be kept")
+		})
+	}
+
+	t.Run("WGS-84 is unchanged", func(t *testing.T) {
+		coords := gmaps.Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+		assert.Equal(t, coords, coords.ToWGS84())
+	})
+}
@@ -0,0 +1,171 @@
+package gmaps
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// TravelMode is how a route is travelled, named as Google Maps names them
+type TravelMode string
+
+const (
+	// TravelModeUnknown is used when the directions URL doesn't say
+	TravelModeUnknown   TravelMode = ""
+	TravelModeDriving   TravelMode = "driving"
+	TravelModeWalking   TravelMode = "walking"
+	TravelModeBicycling TravelMode = "bicycling"
+	TravelModeTransit   TravelMode = "transit"
+)
+
+// Route is a journey between waypoints, from a directions URL
+type Route struct {
+	// Waypoints are the stops along the route in order, starting at the origin and ending at the destination
+	Waypoints []Coordinates `json:"waypoints"`
+
+	Mode TravelMode `json:"mode,omitempty"`
+}
+
+var (
+	// Matches a waypoint's location in the data= parameter of a directions URL, longitude first
+	dataWaypointRegex = regexp.MustCompile(`!2m2!1d(-?\d+\.?\d*)!2d(-?\d+\.?\d*)`)
+
+	// Matches the travel mode in the data= parameter of a directions URL
+	dataTravelModeRegex = regexp.MustCompile(`!3e(\d+)`)
+
+	// Matches a waypoint given as coordinates, like 51.5074,-0.1278 or 51.5074, -0.1278
+	waypointCoordRegex = regexp.MustCompile(`^\s*(-?\d+\.?\d*)\s*,\s*\+?\s*(-?\d+\.?\d*)\s*$`)
+)
+
+// dataTravelModes maps the travel mode numbers in data= parameters to travel modes.
+// Two-wheelers are routed like cars
+var dataTravelModes = map[string]TravelMode{
+	"0": TravelModeDriving,
+	"1": TravelModeBicycling,
+	"2": TravelModeWalking,
+	"3": TravelModeTransit,
+	"9": TravelModeDriving,
+}
+
+// queryTravelMode parses the travelmode query parameter of a directions URL
+func queryTravelMode(travelMode string) TravelMode {
+	switch mode := TravelMode(strings.ToLower(travelMode)); mode {
+	case TravelModeDriving, TravelModeWalking, TravelModeBicycling, TravelModeTransit:
+		return mode
+	case "two-wheeler":
+		return TravelModeDriving
+	default:
+		return TravelModeUnknown
+	}
+}
+
+// isDirectionsURL reports whether u is a Google Maps directions URL, either /maps/dir/origin/destination/...
+// or /maps/dir/?api=1&origin=...&destination=...
+func isDirectionsURL(u *url.URL) bool {
+	return u.Path == "/maps/dir" || strings.HasPrefix(u.Path, "/maps/dir/")
+}
+
+// parseDirectionsURL extracts the route from a directions URL. The returned coordinates are the
+// destination's, with the route attached if at least two waypoints have known locations. Waypoints
+// given by name are located from the data= parameter, and those that can't be located, such as
+// "Your location", are left out
+func parseDirectionsURL(u *url.URL) (*Coordinates, error) {
+	var waypoints []*Coordinates
+	var mode TravelMode
+
+	if query := u.Query(); query.Get("api") == "1" {
+		waypoints = append(waypoints, parseWaypoint(query.Get("origin")))
+		if via := query.Get("waypoints"); via != "" {
+			for _, waypoint := range strings.Split(via, "|") {
+				waypoints = append(waypoints, parseWaypoint(waypoint))
+			}
+		}
+		waypoints = append(waypoints, parseWaypoint(query.Get("destination")))
+		mode = queryTravelMode(query.Get("travelmode"))
+	} else {
+		waypoints, mode = parseDirectionsPath(u)
+	}
+
+	if len(waypoints) == 0 || waypoints[len(waypoints)-1] == nil {
+		return nil, fmt.Errorf("no destination found in directions URL")
+	}
+	destination := *waypoints[len(waypoints)-1]
+
+	route := &Route{Mode: mode}
+	for _, waypoint := range waypoints {
+		if waypoint != nil {
+			route.Waypoints = append(route.Waypoints, *waypoint)
+		}
+	}
+	if len(route.Waypoints) >= 2 {
+		destination.Route = route
+	}
+
+	return &destination, nil
+}
+
+// parseDirectionsPath extracts the waypoints and travel mode from a /maps/dir/origin/destination/@viewport/data=...
+// URL. Waypoints that can't be located are nil
+func parseDirectionsPath(u *url.URL) ([]*Coordinates, TravelMode) {
+	var waypoints []*Coordinates
+	var named []int
+	var data string
+
+	segments := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/maps/dir/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "@") {
+			continue
+		}
+		if strings.HasPrefix(segment, "data=") {
+			data = strings.TrimPrefix(segment, "data=")
+			continue
+		}
+		// Only the trailing slash is empty, an empty waypoint is "Your location"
+		if segment == "" && i == len(segments)-1 {
+			continue
+		}
+
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		waypoint := parseWaypoint(strings.ReplaceAll(unescaped, "+", " "))
+		if waypoint == nil && strings.TrimSpace(unescaped) != "" {
+			named = append(named, len(waypoints))
+		}
+		waypoints = append(waypoints, waypoint)
+	}
+
+	// Named waypoints are located by the data= parameter, in order
+	for i, match := range dataWaypointRegex.FindAllStringSubmatch(data, -1) {
+		if i >= len(named) {
+			break
+		}
+		// Note: order is !1d (lon) !2d (lat)
+		if coords, err := parseCoordMatch(match[2], match[1]); err == nil {
+			waypoints[named[i]] = coords
+		}
+	}
+
+	var mode TravelMode
+	if match := dataTravelModeRegex.FindStringSubmatch(data); match != nil {
+		mode = dataTravelModes[match[1]]
+	}
+
+	return waypoints, mode
+}
+
+// parseWaypoint parses a waypoint given as coordinates, returning nil for anything else
+func parseWaypoint(waypoint string) *Coordinates {
+	match := waypointCoordRegex.FindStringSubmatch(waypoint)
+	if match == nil {
+		return nil
+	}
+
+	coords, err := parseCoordMatch(match[1], match[2])
+	if err != nil {
+		return nil
+	}
+	return coords
+}
@@ -0,0 +1,114 @@
+package gmaps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExtractCoordinatesFromDirections(t *testing.T) {
+	testCases := []struct {
+		name            string
+		url             string
+		expectLat       float64
+		expectLon       float64
+		expectWaypoints [][2]float64
+		expectMode      gmaps.TravelMode
+	}{
+		{
+			name:            "Coordinate waypoints with walking mode",
+			url:             "https://www.google.com/maps/dir/51.5074,-0.1278/51.5014,-0.1419/@51.5044,-0.1348,16z/data=!3m1!4b1!4m2!4m1!3e2",
+			expectLat:       51.5014,
+			expectLon:       -0.1419,
+			expectWaypoints: [][2]float64{{51.5074, -0.1278}, {51.5014, -0.1419}},
+			expectMode:      gmaps.TravelModeWalking,
+		},
+		{
+			name:            "Named waypoints located by data blocks",
+			url:             "https://www.google.com/maps/dir/King's+Cross,+London/British+Museum,+Great+Russell+St,+London/@51.5253,-0.1262,15z/data=!3m1!4b1!4m14!4m13!1m5!1m1!1s0x48761b3b70171395:0x8e9b8b1d3b2a2c5!2m2!1d-0.1240!2d51.5308!1m5!1m1!1s0x48761b323093d307:0x2fb199016d5642a7!2m2!1d-0.1270!2d51.5194!3e1",
+			expectLat:       51.5194,
+			expectLon:       -0.1270,
+			expectWaypoints: [][2]float64{{51.5308, -0.1240}, {51.5194, -0.1270}},
+			expectMode:      gmaps.TravelModeBicycling,
+		},
+		{
+			name:            "Mixed waypoints with a stop in between",
+			url:             "https://www.google.com/maps/dir/51.5074,+-0.1278/Tate+Modern/51.5014,-0.1419/data=!4m11!4m10!1m0!1m5!1m1!1s0x487604a9c2b4b2cb:0x2a8d3f9f6ed5b0a3!2m2!1d-0.0994!2d51.5076!1m0!3e0",
+			expectLat:       51.5014,
+			expectLon:       -0.1419,
+			expectWaypoints: [][2]float64{{51.5074, -0.1278}, {51.5076, -0.0994}, {51.5014, -0.1419}},
+			expectMode:      gmaps.TravelModeDriving,
+		},
+		{
+			name:      "From your location is just the destination",
+			url:       "https://www.google.com/maps/dir//48.8583701,2.2944813/@48.85,2.29,14z",
+			expectLat: 48.8583701,
+			expectLon: 2.2944813,
+		},
+		{
+			name:            "Directions API URL",
+			url:             "https://www.google.com/maps/dir/?api=1&origin=-33.8688,151.2093&destination=-33.8568,151.2153&waypoints=-33.8600,151.2100|Circular+Quay&travelmode=transit",
+			expectLat:       -33.8568,
+			expectLon:       151.2153,
+			expectWaypoints: [][2]float64{{-33.8688, 151.2093}, {-33.8600, 151.2100}, {-33.8568, 151.2153}},
+			expectMode:      gmaps.TravelModeTransit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should be the destination's")
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should be the destination's")
+
+			if tc.expectWaypoints == nil {
+				assert.Nil(t, coords.Route)
+				return
+			}
+
+			require.NotNil(t, coords.Route)
+			require.Len(t, coords.Route.Waypoints, len(tc.expectWaypoints))
+			for i, expected := range tc.expectWaypoints {
+				assert.InDelta(t, expected[0], coords.Route.Waypoints[i].Latitude, 0.0001, "Waypoint %d latitude", i)
+				assert.InDelta(t, expected[1], coords.Route.Waypoints[i].Longitude, 0.0001, "Waypoint %d longitude", i)
+			}
+			assert.Equal(t, tc.expectMode, coords.Route.Mode)
+		})
+	}
+}
+
+func TestDirectionsWithoutLocatedDestinationUsesViewport(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+	coords, err := extractor.ExtractCoordinates(context.Background(), "https://www.google.com/maps/dir/Home/Work/@51.5044,-0.1348,13z")
+	require.NoError(t, err)
+	assert.InDelta(t, 51.5044, coords.Latitude, 0.0001)
+	assert.Nil(t, coords.Route)
+}
+
+func TestDirectionsWaypointsInChinaAreConverted(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+	// From Hong Kong, which uses WGS-84, to Shenzhen, which uses GCJ-02
+	coords, err := extractor.ExtractCoordinates(context.Background(), "https://www.google.com/maps/dir/22.2819,114.1582/22.5431,114.0579/")
+	require.NoError(t, err)
+	require.NotNil(t, coords.Route)
+	assert.Equal(t, gmaps.WGS84, coords.Route.Waypoints[0].Datum)
+	assert.Equal(t, gmaps.GCJ02, coords.Route.Waypoints[1].Datum)
+	assert.True(t, coords.HasGCJ02())
+
+	converted := coords.ToWGS84()
+	assert.False(t, converted.HasGCJ02())
+	assert.Equal(t, coords.Route.Waypoints[0], converted.Route.Waypoints[0], "WGS-84 waypoints are unchanged")
+	assert.Equal(t, gmaps.GCJ02, coords.Route.Waypoints[1].Datum, "The original route isn't modified")
+}
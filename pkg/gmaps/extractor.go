@@ -2,45 +2,72 @@ package gmaps
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
 	"go.uber.org/zap"
 )
 
 // Coordinates represents a latitude/longitude pair
 type Coordinates struct {
-	Latitude  float64
-	Longitude float64
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	// Zoom is the map zoom level from the source URL, or 0 if it didn't specify one
+	Zoom int `json:"zoom,omitempty"`
+
+	// Datum is the datum Latitude and Longitude are expressed in
+	Datum Datum `json:"datum"`
+
+	// Route is the journey a directions URL describes, ending at these coordinates, or nil for a single location
+	Route *Route `json:"route,omitempty"`
 }
 
+// ErrNoCoordinates is returned, wrapped, when a link definitely doesn't lead to coordinates, as
+// opposed to failing for a reason that trying again later might fix
+var ErrNoCoordinates = errors.New("no coordinates found")
+
+// ErrThrottled is returned, wrapped, when a map site is rate limiting the bot
+var ErrThrottled = errors.New("throttling requests, try again later")
+
 // HTTPClient interface for making HTTP requests (for testing and rate limiting)
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// Extractor handles extracting coordinates from Google Maps URLs
+// Extractor handles extracting coordinates from map links
 type Extractor struct {
-	client HTTPClient
-	logger *zap.SugaredLogger
+	client       HTTPClient
+	maxRedirects int
+	cache        *ResolutionCache
+	logger       *zap.SugaredLogger
 }
 
-// NewExtractor creates a new coordinate extractor
-func NewExtractor(client HTTPClient, logger *zap.SugaredLogger) *Extractor {
+// NewExtractor creates a new coordinate extractor which follows at most maxRedirects redirects per URL
+func NewExtractor(client HTTPClient, maxRedirects int, logger *zap.SugaredLogger) *Extractor {
 	return &Extractor{
-		client: client,
-		logger: logger,
+		client:       client,
+		maxRedirects: maxRedirects,
+		logger:       logger,
 	}
 }
 
+// SetCache makes the extractor remember what links it followed resolved to in cache
+func (e *Extractor) SetCache(cache *ResolutionCache) {
+	e.cache = cache
+}
+
 // Common coordinate patterns in Google Maps URLs
 var (
 	// Matches @lat,lon,zoom or @lat,lon
-	atCoordRegex = regexp.MustCompile(`@(-?\d+\.?\d*),(-?\d+\.?\d*)(?:,[\d.]+z)?`)
+	atCoordRegex = regexp.MustCompile(`@(-?\d+\.?\d*),(-?\d+\.?\d*)(?:,([\d.]+)z)?`)
 
 	// Matches /search/lat,lon or /search/lat,+lon (from redirected shortened URLs)
 	searchCoordRegex = regexp.MustCompile(`/search/(-?\d+\.?\d*),\s*\+?\s*(-?\d+\.?\d*)`)
@@ -55,71 +82,258 @@ var (
 	dataCoordRegex = regexp.MustCompile(`!3d(-?\d+\.?\d*)!4d(-?\d+\.?\d*)`)
 )
 
-// ExtractCoordinates attempts to extract coordinates from a Google Maps URL
-// It first tries to parse directly from the URL, then follows redirects if needed
+// Names of the URL patterns coordinates can be found with, used to label metrics
+const (
+	patternAt         = "at"
+	patternSearch     = "search"
+	patternData       = "data"
+	patternLL         = "ll"
+	patternQ          = "q"
+	patternCenter     = "center"
+	patternDirections = "directions"
+	patternPlusCode   = "plus_code"
+	patternNone       = "none"
+)
+
+// ExtractCoordinates attempts to extract coordinates from a link to any registered source
+// It first tries to parse directly from the URL, then follows redirects if needed.
+// Points in mainland China are flagged as GCJ-02 if the source uses the datum maps there are required to
 func (e *Extractor) ExtractCoordinates(ctx context.Context, urlStr string) (*Coordinates, error) {
 	// First try to extract directly from the URL
-	coords, err := e.parseCoordinatesFromURL(urlStr)
+	coords, pattern, err := e.parseCoordinatesFromURL(urlStr)
 	if err == nil {
 		e.logger.Debugw("Extracted coordinates directly from URL", "url", urlStr, "coords", coords)
+		metrics.Conversions.WithLabelValues("direct", pattern, "success").Inc()
 		return coords, nil
 	}
 
 	e.logger.Debugw("Could not extract from URL directly, following redirects", "url", urlStr, "error", err)
 
-	// If that fails, follow the URL and try to extract from the final destination
-	return e.extractByFollowingURL(ctx, urlStr)
+	// If that fails, follow the URL and try to extract from the final destination. Short plus codes
+	// in text are followed as a Google Maps search, which finds their locality
+	followURL := urlStr
+	if searchURL, ok := shortPlusCodeSearchURL(urlStr); ok {
+		followURL = searchURL
+	}
+	coords, redirectPattern, err := e.cachedExtractByFollowingURL(ctx, followURL)
+	if err != nil {
+		// Label failures with what the shared URL looked like
+		metrics.Conversions.WithLabelValues("redirect", pattern, "failure").Inc()
+		return nil, err
+	}
+	metrics.Conversions.WithLabelValues("redirect", redirectPattern, "success").Inc()
+	return coords, nil
+}
+
+// wgs84Patterns are the patterns whose coordinates are WGS-84 whichever source they're found in:
+// geo: URIs and plus codes by definition, and coordinates typed into a post, which come from GPS
+var wgs84Patterns = map[string]bool{
+	patternGeoURI:   true,
+	patternPlusCode: true,
+	patternDecimal:  true,
+	patternDMS:      true,
 }
 
-// parseCoordinatesFromURL tries to extract coordinates directly from the URL string
-func (e *Extractor) parseCoordinatesFromURL(urlStr string) (*Coordinates, error) {
+// markDatum sets the datum the source uses at the coordinates' location, and at each waypoint of
+// their route, unless the pattern they were found with is always WGS-84
+func markDatum(coords *Coordinates, pattern string, s Source) *Coordinates {
+	if wgs84Patterns[pattern] {
+		return coords
+	}
+
+	coords.Datum = s.Datum(coords.Latitude, coords.Longitude)
+	if coords.Route != nil {
+		for i := range coords.Route.Waypoints {
+			markDatum(&coords.Route.Waypoints[i], pattern, s)
+		}
+	}
+	return coords
+}
+
+// parseGoogleMapsURL tries to extract coordinates directly from a Google Maps URL. It also
+// returns the name of the pattern that matched, even if the coordinates were invalid
+func parseGoogleMapsURL(urlStr string) (*Coordinates, string, error) {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid URL: %w", err)
+		return nil, patternNone, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	// Directions URLs also have an @lat,lon viewport, which isn't where anyone is going
+	if isDirectionsURL(parsedURL) {
+		if coords, err := parseDirectionsURL(parsedURL); err == nil {
+			return coords, patternDirections, nil
+		}
+	}
+
+	// Plus codes searched for or placed are more precise than the viewport
+	if coords, err := parsePlusCodeURL(parsedURL, urlStr); err == nil {
+		return coords, patternPlusCode, nil
 	}
 
 	// Try @lat,lon pattern (most common in modern Google Maps URLs)
 	if match := atCoordRegex.FindStringSubmatch(urlStr); match != nil {
-		return parseCoordMatch(match[1], match[2])
+		coords, err := parseCoordMatch(match[1], match[2])
+		if err == nil {
+			coords.Zoom = parseZoom(match[3])
+		}
+		return coords, patternAt, err
 	}
 
 	// Try /search/lat,lon pattern (common in redirected shortened URLs)
 	if match := searchCoordRegex.FindStringSubmatch(urlStr); match != nil {
-		return parseCoordMatch(match[1], match[2])
+		coords, err := parseCoordMatch(match[1], match[2])
+		return coords, patternSearch, err
 	}
 
 	// Try !3d!4d pattern (in data= parameter)
 	if match := dataCoordRegex.FindStringSubmatch(urlStr); match != nil {
 		// Note: order is !3d (lat) !4d (lon)
-		return parseCoordMatch(match[1], match[2])
+		coords, err := parseCoordMatch(match[1], match[2])
+		return coords, patternData, err
 	}
 
+	// Legacy URLs with ll= or q= carry the zoom in a z= query parameter
+	query := parsedURL.Query()
+
 	// Try ll= query parameter
 	if match := llParamRegex.FindStringSubmatch(urlStr); match != nil {
-		return parseCoordMatch(match[1], match[2])
+		coords, err := parseCoordMatch(match[1], match[2])
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("z"))
+		}
+		return coords, patternLL, err
 	}
 
 	// Try q= query parameter
 	if match := qCoordRegex.FindStringSubmatch(urlStr); match != nil {
-		return parseCoordMatch(match[1], match[2])
+		coords, err := parseCoordMatch(match[1], match[2])
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("z"))
+		}
+		return coords, patternQ, err
 	}
 
 	// Check query parameters more thoroughly
-	query := parsedURL.Query()
 
 	// Check center parameter
 	if center := query.Get("center"); center != "" {
 		parts := strings.Split(center, ",")
 		if len(parts) == 2 {
-			return parseCoordMatch(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			coords, err := parseCoordMatch(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			return coords, patternCenter, err
 		}
 	}
 
-	return nil, fmt.Errorf("no coordinates found in URL")
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
 }
 
-// extractByFollowingURL makes an HTTP HEAD request and extracts coordinates from the Location header
-func (e *Extractor) extractByFollowingURL(ctx context.Context, urlStr string) (*Coordinates, error) {
+// extractByFollowingURL walks the redirect chain with HTTP HEAD requests, up to maxRedirects hops,
+// trying to extract coordinates from every Location header along the way. Consent and other
+// interstitial pages are skipped by resuming from their continue parameter. If the chain ends at
+// a page without coordinates in its URL, the page itself is fetched and searched. It also returns
+// the name of the pattern the coordinates were found with
+func (e *Extractor) extractByFollowingURL(ctx context.Context, urlStr string) (*Coordinates, string, error) {
+	current, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	chain := []string{current.String()}
+	redirects := 0
+
+	// The shared link may itself be an interstitial
+	if target, ok := unwrapInterstitial(current); ok {
+		chain = append(chain, target.String())
+		e.logger.Debugw("Skipping interstitial page", "interstitial", current.String(), "continue", target.String())
+
+		if coords, pattern, err := e.parseCoordinatesFromURL(target.String()); err == nil {
+			return coords, pattern, nil
+		}
+		current = target
+	}
+
+	for {
+		resp, err := e.head(ctx, current.String())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to fetch URL (redirect chain: %s): %w", formatChain(chain), err)
+		}
+
+		// For redirect responses (3xx), check the Location header
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			location := resp.Header.Get("Location")
+			if location == "" {
+				return nil, "", fmt.Errorf("redirect without Location header: status %d (redirect chain: %s)", resp.StatusCode, formatChain(chain))
+			}
+
+			if redirects >= e.maxRedirects {
+				return nil, "", fmt.Errorf("stopped after %d redirects: %w (redirect chain: %s)", e.maxRedirects, ErrNoCoordinates, formatChain(chain))
+			}
+
+			// Location may be relative to the URL that redirected
+			next, err := current.Parse(location)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid redirect location %q (redirect chain: %s): %w", location, formatChain(chain), err)
+			}
+
+			redirects++
+			chain = append(chain, next.String())
+			e.logger.Debugw("Got redirect location", "original", urlStr, "location", next.String(), "hop", redirects)
+
+			// Resume from the real destination rather than fetching a consent page
+			if target, ok := unwrapInterstitial(next); ok {
+				chain = append(chain, target.String())
+				e.logger.Debugw("Skipping interstitial page", "interstitial", next.String(), "continue", target.String())
+				next = target
+			}
+
+			if coords, pattern, err := e.parseCoordinatesFromURL(next.String()); err == nil {
+				e.logger.Debugw("Extracted coordinates from redirect chain", "chain", chain, "coords", coords)
+				return coords, pattern, nil
+			}
+
+			current = next
+			continue
+		}
+
+		// For non-redirect responses, try to use the request URL in case the client followed redirects itself
+		if resp.StatusCode == http.StatusOK && resp.Request != nil && resp.Request.URL.String() != current.String() {
+			finalURL := resp.Request.URL.String()
+			chain = append(chain, finalURL)
+			e.logger.Debugw("Followed redirects to final URL", "original", urlStr, "final", finalURL)
+			if coords, pattern, err := e.parseCoordinatesFromURL(finalURL); err == nil {
+				return coords, pattern, nil
+			}
+		}
+
+		e.logger.Debugw("Redirect chain ended without coordinates", "chain", chain, "status", resp.StatusCode)
+
+		// Places shared without coordinates in their URL still have them in the page
+		if resp.StatusCode == http.StatusOK {
+			pageURL := current.String()
+			if resp.Request != nil {
+				pageURL = resp.Request.URL.String()
+			}
+
+			coords, pattern, err := e.extractFromPage(ctx, pageURL)
+			if err != nil {
+				return nil, "", fmt.Errorf("%w (redirect chain: %s)", err, formatChain(chain))
+			}
+			e.logger.Debugw("Extracted coordinates from page", "url", pageURL, "coords", coords, "pattern", pattern)
+			return markDatum(coords, pattern, sourceOrGoogleMaps(pageURL)), pattern, nil
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			return nil, "", fmt.Errorf("%s is %w: status %d (redirect chain: %s)", current.Hostname(), ErrThrottled, resp.StatusCode, formatChain(chain))
+		}
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			// The link is broken, which trying again won't change
+			return nil, "", fmt.Errorf("%w, link is broken: status %d (redirect chain: %s)", ErrNoCoordinates, resp.StatusCode, formatChain(chain))
+		}
+		return nil, "", fmt.Errorf("no redirect or valid response: status %d (redirect chain: %s)", resp.StatusCode, formatChain(chain))
+	}
+}
+
+// head makes an HTTP HEAD request for urlStr, closing the body which HEAD responses don't have
+func (e *Extractor) head(ctx context.Context, urlStr string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "HEAD", urlStr, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -130,27 +344,16 @@ func (e *Extractor) extractByFollowingURL(ctx context.Context, urlStr string) (*
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// For redirect responses (3xx), check the Location header
-	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
-		location := resp.Header.Get("Location")
-		if location != "" {
-			e.logger.Debugw("Got redirect location", "original", urlStr, "location", location)
-			return e.parseCoordinatesFromURL(location)
-		}
+		return nil, err
 	}
+	resp.Body.Close()
 
-	// For non-redirect responses, try to use the request URL after any automatic redirects
-	if resp.StatusCode == http.StatusOK && resp.Request != nil {
-		finalURL := resp.Request.URL.String()
-		e.logger.Debugw("Followed redirects to final URL", "original", urlStr, "final", finalURL)
-		return e.parseCoordinatesFromURL(finalURL)
-	}
+	return resp, nil
+}
 
-	return nil, fmt.Errorf("no redirect or valid response: status %d", resp.StatusCode)
+// formatChain formats a redirect chain for error messages
+func formatChain(chain []string) string {
+	return strings.Join(chain, " -> ")
 }
 
 // parseCoordMatch parses coordinate strings into a Coordinates struct
@@ -165,7 +368,11 @@ func parseCoordMatch(latStr, lonStr string) (*Coordinates, error) {
 		return nil, fmt.Errorf("invalid longitude: %w", err)
 	}
 
-	// Validate coordinate ranges
+	return newCoordinates(lat, lon)
+}
+
+// newCoordinates returns the coordinates of lat, lon if they are in range
+func newCoordinates(lat, lon float64) (*Coordinates, error) {
 	if lat < -90 || lat > 90 {
 		return nil, fmt.Errorf("latitude out of range: %f", lat)
 	}
@@ -175,3 +382,12 @@ func parseCoordMatch(latStr, lonStr string) (*Coordinates, error) {
 
 	return &Coordinates{Latitude: lat, Longitude: lon}, nil
 }
+
+// parseZoom parses a possibly fractional zoom level, returning 0 if it is missing or invalid
+func parseZoom(zoomStr string) int {
+	zoom, err := strconv.ParseFloat(zoomStr, 64)
+	if err != nil || zoom < 0 {
+		return 0
+	}
+	return int(math.Round(zoom))
+}
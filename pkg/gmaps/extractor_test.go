@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
@@ -146,7 +148,7 @@ func TestExtractCoordinates(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			logger := zaptest.NewLogger(t).Sugar()
 			mockClient := &mockHTTPClient{}
-			extractor := gmaps.NewExtractor(mockClient, logger)
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
 
 			ctx := context.Background()
 			coords, err := extractor.ExtractCoordinates(ctx, tc.url)
@@ -216,7 +218,7 @@ func TestCoordinateValidation(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			logger := zaptest.NewLogger(t).Sugar()
 			mockClient := &mockHTTPClient{}
-			extractor := gmaps.NewExtractor(mockClient, logger)
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
 
 			ctx := context.Background()
 			coords, err := extractor.ExtractCoordinates(ctx, tc.url)
@@ -232,6 +234,51 @@ func TestCoordinateValidation(t *testing.T) {
 	}
 }
 
+func TestExtractZoom(t *testing.T) {
+	testCases := []struct {
+		name       string
+		url        string
+		expectZoom int
+	}{
+		{
+			name:       "At-coordinate format with zoom",
+			url:        "https://www.google.com/maps/@37.7749,-122.4194,15z",
+			expectZoom: 15,
+		},
+		{
+			name:       "Fractional zoom is rounded",
+			url:        "https://www.google.com/maps/place/Sydney+NSW/@-33.8688,151.2093,12.6z",
+			expectZoom: 13,
+		},
+		{
+			name:       "At-coordinate format without zoom",
+			url:        "https://www.google.com/maps/@-33.8688,151.2093",
+			expectZoom: 0,
+		},
+		{
+			name:       "Legacy ll= with z= parameter",
+			url:        "https://maps.google.com/maps?ll=40.7128,-74.0060&z=11",
+			expectZoom: 11,
+		},
+		{
+			name:       "Data format has no zoom",
+			url:        "https://www.google.com/maps/place/Mussenden+Temple/data=!4m7!3m6!8m2!3d55.1677806!4d-6.8108972",
+			expectZoom: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectZoom, coords.Zoom)
+		})
+	}
+}
+
 // mockRedirectHTTPClient simulates HTTP HEAD requests with 302 redirects
 type mockRedirectHTTPClient struct {
 	redirectMap map[string]string
@@ -295,7 +342,7 @@ func TestExtractCoordinatesWithRedirect(t *testing.T) {
 				},
 			}
 
-			extractor := gmaps.NewExtractor(mockClient, logger)
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
 
 			ctx := context.Background()
 			coords, err := extractor.ExtractCoordinates(ctx, tc.url)
@@ -312,3 +359,252 @@ func TestExtractCoordinatesWithRedirect(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractCoordinatesFollowsRedirectChain(t *testing.T) {
+	chain := map[string]string{
+		"https://maps.app.goo.gl/MultiHop":          "https://goo.gl/maps/intermediate",
+		"https://goo.gl/maps/intermediate":          "https://www.google.com/url?q=next",
+		"https://www.google.com/url?q=next":         "/maps/place/Somewhere/data=!3d55.1677806!4d-6.8108972",
+		"https://maps.app.goo.gl/Loop":              "https://maps.app.goo.gl/Loop2",
+		"https://maps.app.goo.gl/Loop2":             "https://maps.app.goo.gl/Loop",
+		"https://maps.app.goo.gl/NoCoordinatesEver": "https://www.google.com/maps/search/restaurants",
+	}
+
+	testCases := []struct {
+		name         string
+		url          string
+		maxRedirects int
+		expectLat    float64
+		expectLon    float64
+		errContains  string
+	}{
+		{
+			name:         "Coordinates after several hops with a relative Location",
+			url:          "https://maps.app.goo.gl/MultiHop",
+			maxRedirects: 5,
+			expectLat:    55.1677806,
+			expectLon:    -6.8108972,
+		},
+		{
+			name:         "Chain longer than max redirects",
+			url:          "https://maps.app.goo.gl/MultiHop",
+			maxRedirects: 2,
+			errContains:  "stopped after 2 redirects",
+		},
+		{
+			name:         "Redirect loop is bounded",
+			url:          "https://maps.app.goo.gl/Loop",
+			maxRedirects: 5,
+			errContains:  "https://maps.app.goo.gl/Loop -> https://maps.app.goo.gl/Loop2 -> https://maps.app.goo.gl/Loop",
+		},
+		{
+			name:         "Error reports the full chain",
+			url:          "https://maps.app.goo.gl/NoCoordinatesEver",
+			maxRedirects: 5,
+			errContains:  "https://maps.app.goo.gl/NoCoordinatesEver -> https://www.google.com/maps/search/restaurants",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			mockClient := &mockRedirectHTTPClient{redirectMap: chain}
+			extractor := gmaps.NewExtractor(mockClient, tc.maxRedirects, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				assert.Nil(t, coords)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, coords)
+				assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+				assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+			}
+		})
+	}
+}
+
+func TestExtractCoordinatesThroughConsentInterstitial(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		redirects   map[string]string
+		expectLat   float64
+		expectLon   float64
+		errContains string
+	}{
+		{
+			name: "Consent page with encoded continue URL",
+			url:  "https://maps.app.goo.gl/Consent1",
+			redirects: map[string]string{
+				"https://maps.app.goo.gl/Consent1": "https://consent.google.com/ml?continue=https://www.google.com/maps/search/20.533907,%2B27.158833?entry%3Dtts&gl=GB&m=0&pc=m&uxe=eomtm&cm=2&hl=en&src=1",
+			},
+			expectLat: 20.533907,
+			expectLon: 27.158833,
+		},
+		{
+			name: "Consent page with fully percent-encoded continue URL",
+			url:  "https://maps.app.goo.gl/Consent2",
+			redirects: map[string]string{
+				"https://maps.app.goo.gl/Consent2": "https://consent.google.com/m?continue=https%3A%2F%2Fwww.google.com%2Fmaps%2Fplace%2FMussenden%2BTemple%2Fdata%3D!4m7!3m6!8m2!3d55.1677806!4d-6.8108972%3Fentry%3Dtts&gl=DE&m=0&pc=m&cm=2&hl=de&src=1",
+			},
+			expectLat: 55.1677806,
+			expectLon: -6.8108972,
+		},
+		{
+			name: "Country-specific consent host",
+			url:  "https://goo.gl/maps/Consent3",
+			redirects: map[string]string{
+				"https://goo.gl/maps/Consent3": "https://consent.google.co.uk/ml?continue=https%3A%2F%2Fmaps.google.com%2Fmaps%3Fq%3D51.5074%2C-0.1278&hl=en-GB",
+			},
+			expectLat: 51.5074,
+			expectLon: -0.1278,
+		},
+		{
+			name: "Resolution resumes from the continue URL",
+			url:  "https://maps.app.goo.gl/Consent4",
+			redirects: map[string]string{
+				"https://maps.app.goo.gl/Consent4":         "https://consent.google.com/ml?continue=https://maps.app.goo.gl/Consent4?g_st%3Dic&gl=FR",
+				"https://maps.app.goo.gl/Consent4?g_st=ic": "https://www.google.com/maps/place/Eiffel+Tower/@48.8583701,2.2944813,17z",
+			},
+			expectLat: 48.8583701,
+			expectLon: 2.2944813,
+		},
+		{
+			name: "Nested interstitials",
+			url:  "https://maps.app.goo.gl/Consent5",
+			redirects: map[string]string{
+				"https://maps.app.goo.gl/Consent5": "https://www.google.com/sorry/index?continue=https://consent.google.com/ml%3Fcontinue%3Dhttps://www.google.com/maps/@-33.8688,151.2093,12z%26gl%3DAU&q=EgQ",
+			},
+			expectLat: -33.8688,
+			expectLon: 151.2093,
+		},
+		{
+			name:      "Shared link is itself a consent page",
+			url:       "https://consent.google.com/ml?continue=https://www.google.com/maps/@37.7749,-122.4194,15z&gl=US",
+			redirects: map[string]string{},
+			expectLat: 37.7749,
+			expectLon: -122.4194,
+		},
+		{
+			name: "Consent page without continue parameter",
+			url:  "https://maps.app.goo.gl/Consent6",
+			redirects: map[string]string{
+				"https://maps.app.goo.gl/Consent6": "https://consent.google.com/ml?gl=GB",
+			},
+			errContains: "https://maps.app.goo.gl/Consent6 -> https://consent.google.com/ml?gl=GB",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			mockClient := &mockRedirectHTTPClient{redirectMap: tc.redirects}
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				assert.Nil(t, coords)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, coords)
+				assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+				assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+			}
+		})
+	}
+}
+
+func TestExtractCoordinatesMarksDatum(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		expectDatum gmaps.Datum
+	}{
+		{
+			name:        "Beijing uses GCJ-02",
+			url:         "https://www.google.com/maps/place/Tiananmen/@39.9087243,116.3952859,17z",
+			expectDatum: gmaps.GCJ02,
+		},
+		{
+			name:        "Hong Kong uses WGS-84",
+			url:         "https://www.google.com/maps/@22.2819,114.1582,15z",
+			expectDatum: gmaps.WGS84,
+		},
+		{
+			name:        "London uses WGS-84",
+			url:         "https://maps.google.com/maps?q=51.5074,-0.1278",
+			expectDatum: gmaps.WGS84,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDatum, coords.Datum)
+		})
+	}
+}
+
+func TestExtractCoordinatesRecordsPattern(t *testing.T) {
+	redirects := map[string]string{
+		"https://maps.app.goo.gl/Metrics": "https://www.google.com/maps/search/20.533907,+27.158833?entry=tts",
+	}
+
+	testCases := []struct {
+		name    string
+		url     string
+		method  string
+		pattern string
+		result  string
+	}{
+		{
+			name:    "Direct at-coordinates",
+			url:     "https://www.google.com/maps/@37.7749,-122.4194,15z",
+			method:  "direct",
+			pattern: "at",
+			result:  "success",
+		},
+		{
+			name:    "Direct data parameter",
+			url:     "https://www.google.com/maps/place/Tokyo/data=!3d35.6762!4d139.6503",
+			method:  "direct",
+			pattern: "data",
+			result:  "success",
+		},
+		{
+			name:    "Search URL found by following the redirect",
+			url:     "https://maps.app.goo.gl/Metrics",
+			method:  "redirect",
+			pattern: "search",
+			result:  "success",
+		},
+		{
+			name:    "Failure",
+			url:     "https://maps.app.goo.gl/Unknown",
+			method:  "redirect",
+			pattern: "none",
+			result:  "failure",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			counter := metrics.Conversions.WithLabelValues(tc.method, tc.pattern, tc.result)
+			before := testutil.ToFloat64(counter)
+
+			extractor := gmaps.NewExtractor(&mockRedirectHTTPClient{redirectMap: redirects}, 5, zaptest.NewLogger(t).Sugar())
+			_, _ = extractor.ExtractCoordinates(context.Background(), tc.url)
+
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package gmaps
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ExtractMapURLsFromHTML finds the links to every registered source in Mastodon status HTML.
+// Linked URLs are taken from <a href> rather than the displayed text, which Mastodon
+// truncates, and mention and hashtag links are ignored. Only text outside links is
+// scanned for URLs that weren't linkified
+func ExtractMapURLsFromHTML(content string) []string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		// Not expected, the parser recovers from malformed HTML
+		return ExtractMapURLs(html.UnescapeString(content))
+	}
+
+	urls := make([]string, 0)
+	var text strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.ElementNode && n.DataAtom == atom.A:
+			if href := attribute(n, "href"); !isMentionOrHashtag(n) && IsMapURL(href) {
+				urls = append(urls, href)
+			}
+			// Don't scan the displayed link text, it's truncated with ellipses
+			return
+		case n.Type == html.TextNode:
+			text.WriteString(n.Data)
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Br || n.DataAtom == atom.P):
+			// Keep line and paragraph breaks from joining words together
+			text.WriteString(" ")
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	urls = append(urls, ExtractMapURLs(text.String())...)
+
+	return deduplicate(urls)
+}
+
+// isMentionOrHashtag reports whether the link is a Mastodon mention or hashtag
+func isMentionOrHashtag(n *html.Node) bool {
+	classes := strings.Fields(attribute(n, "class"))
+	rels := strings.Fields(attribute(n, "rel"))
+	return slices.Contains(classes, "mention") || slices.Contains(classes, "hashtag") || slices.Contains(rels, "tag")
+}
+
+// attribute returns the value of the named attribute, or "" if it isn't set
+func attribute(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
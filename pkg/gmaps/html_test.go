@@ -0,0 +1,91 @@
+package gmaps_test
+
+import (
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractMapURLsFromHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "No URLs",
+			content:  `<p>Just saying hello</p>`,
+			expected: []string{},
+		},
+		{
+			name: "Truncated link text uses the href",
+			content: `<p><span class="h-card" translate="no"><a href="https://c.im/@gMapsToOSM" class="u-url mention">@<span>gMapsToOSM</span></a></span> ` +
+				`<a href="https://www.google.com/maps/place/Mussenden+Temple/@55.1677806,-6.8108972,17z/data=!3m1!4b1" target="_blank" rel="nofollow noopener noreferrer" translate="no">` +
+				`<span class="invisible">https://www.</span><span class="ellipsis">google.com/maps/place/Mussenden</span><span class="invisible">+Temple/@55.1677806,-6.8108972,17z/data=!3m1!4b1</span></a></p>`,
+			expected: []string{"https://www.google.com/maps/place/Mussenden+Temple/@55.1677806,-6.8108972,17z/data=!3m1!4b1"},
+		},
+		{
+			name:     "Escaped ampersands in href are unescaped",
+			content:  `<p><a href="https://maps.google.com/maps?ll=40.7128,-74.0060&amp;z=11&amp;q=Somewhere" rel="nofollow noopener noreferrer"><span class="invisible">https://</span><span class="ellipsis">maps.google.com/maps?ll=40.7128</span><span class="invisible">,-74.0060&amp;z=11&amp;q=Somewhere</span></a></p>`,
+			expected: []string{"https://maps.google.com/maps?ll=40.7128,-74.0060&z=11&q=Somewhere"},
+		},
+		{
+			name:     "Short link",
+			content:  `<p>Party here! <a href="https://maps.app.goo.gl/XyZ123" target="_blank" rel="nofollow noopener noreferrer" translate="no"><span class="invisible">https://</span><span class="">maps.app.goo.gl/XyZ123</span><span class="invisible"></span></a></p>`,
+			expected: []string{"https://maps.app.goo.gl/XyZ123"},
+		},
+		{
+			name:     "Mentions, hashtags and other links are ignored",
+			content:  `<p><a href="https://google.com/maps/tags/maps" class="mention hashtag" rel="tag">#<span>maps</span></a> <a href="https://www.google.com/maps/@1,2,3z" class="u-url mention">@<span>someone</span></a> <a href="https://example.com/">example.com</a></p>`,
+			expected: []string{},
+		},
+		{
+			name:     "Un-linkified URL in text",
+			content:  `<p>Plain text link https://maps.google.com/maps?q=51.5074,-0.1278&amp;z=15<br>on its own line</p>`,
+			expected: []string{"https://maps.google.com/maps?q=51.5074,-0.1278&z=15"},
+		},
+		{
+			name:     "Paragraphs don't join URLs to following words",
+			content:  `<p>https://goo.gl/maps/abc123</p><p>second paragraph</p>`,
+			expected: []string{"https://goo.gl/maps/abc123"},
+		},
+		{
+			name:     "Duplicates between links and text",
+			content:  `<p><a href="https://goo.gl/maps/abc123">goo.gl/maps/abc123</a> and again https://goo.gl/maps/abc123</p>`,
+			expected: []string{"https://goo.gl/maps/abc123"},
+		},
+		{
+			name:     "Plain text without markup",
+			content:  "Visit https://maps.app.goo.gl/XyZ123",
+			expected: []string{"https://maps.app.goo.gl/XyZ123"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := gmaps.ExtractMapURLsFromHTML(tc.content)
+			assert.ElementsMatch(t, tc.expected, result, "URLs should match")
+		})
+	}
+}
+
+func TestIsMapURLWithGoogleMapsLinks(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://www.google.com/maps/@37.7749,-122.4194,15z", true},
+		{"https://maps.app.goo.gl/XyZ123", true},
+		{"https://goo.gl/maps/abc123", true},
+		{"https://example.com/?u=https://goo.gl/maps/abc123", false},
+		{"https://goo.gl/maps/abc123 trailing", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			assert.Equal(t, tc.expected, gmaps.IsMapURL(tc.url))
+		})
+	}
+}
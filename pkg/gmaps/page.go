@@ -0,0 +1,178 @@
+package gmaps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxPageSize is how much of a page is read when looking for coordinates in it. Google Maps
+// pages put the tags and state the coordinates are found in well before this
+const maxPageSize = 2 << 20
+
+// Patterns coordinates can be found with in a page, used to label metrics like the URL patterns
+const (
+	patternOGImage  = "og_image"
+	patternMeta     = "meta"
+	patternAppState = "app_state"
+)
+
+// Matches the start of Google Maps' initial map state, whose viewport begins [[[altitude,lon,lat]
+var appStateRegex = regexp.MustCompile(`APP_INITIALIZATION_STATE\s*=\s*\[\[\[\s*-?[\d.eE+-]+\s*,\s*(-?\d+\.?\d*)\s*,\s*(-?\d+\.?\d*)\s*\]`)
+
+// extractFromPage fetches the page at urlStr with a GET request and looks for coordinates in it,
+// for places whose URLs don't include them. Only the first maxPageSize bytes are read
+func (e *Extractor) extractFromPage(ctx context.Context, urlStr string) (*Coordinates, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set a reasonable User-Agent
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; gMapsToOSM-bot/1.0)")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		return nil, "", fmt.Errorf("%s is %w: status %d", req.URL.Hostname(), ErrThrottled, resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, "", fmt.Errorf("failed to fetch page: status %d: %w", resp.StatusCode, ErrNoCoordinates)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch page: status %d", resp.StatusCode)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read page: %w", err)
+	}
+
+	return parseCoordinatesFromPage(page)
+}
+
+// parseCoordinatesFromPage looks for coordinates in a Google Maps page: in the static map used as
+// its og:image, in geo <meta> tags, and in the initial map state. It also returns the name of the
+// pattern that matched
+func parseCoordinatesFromPage(page []byte) (*Coordinates, string, error) {
+	meta := pageMeta(page)
+
+	// The preview image is pinned on the place itself
+	if image := meta["og:image"]; image != "" {
+		if coords, err := parseStaticMapURL(image); err == nil {
+			return coords, patternOGImage, nil
+		}
+	}
+
+	if coords, err := parseGeoMeta(meta); err == nil {
+		return coords, patternMeta, nil
+	}
+
+	// The initial viewport is centred on the place
+	if match := appStateRegex.FindSubmatch(page); match != nil {
+		// Note: order is lon, lat
+		coords, err := parseCoordMatch(string(match[2]), string(match[1]))
+		return coords, patternAppState, err
+	}
+
+	return nil, patternNone, fmt.Errorf("%w in page", ErrNoCoordinates)
+}
+
+// pageMeta returns the content of the page's <meta> tags, keyed by their lowercased property,
+// name or itemprop. The first tag with each key wins
+func pageMeta(page []byte) map[string]string {
+	meta := map[string]string{}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			// Either the end of the page or as much as was read of it
+			return meta
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.DataAtom == atom.Body {
+				// <meta> tags belong in the head
+				return meta
+			}
+			if token.DataAtom != atom.Meta {
+				continue
+			}
+
+			var key, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "property", "name", "itemprop":
+					key = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			if _, ok := meta[key]; key != "" && !ok {
+				meta[key] = content
+			}
+		}
+	}
+}
+
+// parseStaticMapURL extracts the coordinates a static map image is pinned on, from its markers
+// parameter, or failing that centred on, from its center parameter
+func parseStaticMapURL(imageURL string) (*Coordinates, error) {
+	parsedURL, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image URL: %w", err)
+	}
+	query := parsedURL.Query()
+
+	// Markers are styles and locations separated by |, e.g. color:red|51.5,-0.12
+	var candidates []string
+	for _, markers := range query["markers"] {
+		candidates = append(candidates, strings.Split(markers, "|")...)
+	}
+	candidates = append(candidates, query.Get("center"))
+
+	for _, candidate := range candidates {
+		lat, lon, ok := strings.Cut(candidate, ",")
+		if !ok {
+			continue
+		}
+		coords, err := parseCoordMatch(strings.TrimSpace(lat), strings.TrimSpace(lon))
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("zoom"))
+			return coords, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no coordinates found in image URL")
+}
+
+// parseGeoMeta extracts coordinates from OpenGraph place, geo.position or ICBM <meta> tags
+func parseGeoMeta(meta map[string]string) (*Coordinates, error) {
+	if lat, lon := meta["place:location:latitude"], meta["place:location:longitude"]; lat != "" && lon != "" {
+		return parseCoordMatch(strings.TrimSpace(lat), strings.TrimSpace(lon))
+	}
+
+	// geo.position is lat;lon
+	if lat, lon, ok := strings.Cut(meta["geo.position"], ";"); ok {
+		return parseCoordMatch(strings.TrimSpace(lat), strings.TrimSpace(lon))
+	}
+
+	// ICBM is lat, lon
+	if lat, lon, ok := strings.Cut(meta["icbm"], ","); ok {
+		return parseCoordMatch(strings.TrimSpace(lat), strings.TrimSpace(lon))
+	}
+
+	return nil, fmt.Errorf("no geo meta tags found")
+}
@@ -0,0 +1,166 @@
+package gmaps_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// mockPageHTTPClient redirects like mockRedirectHTTPClient and serves pages at the end of the chain,
+// with their bodies only in response to GET
+type mockPageHTTPClient struct {
+	redirectMap map[string]string
+	pages       map[string]string
+	statuses    map[string]int
+}
+
+func (m *mockPageHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	originalURL := req.URL.String()
+
+	if locationURL, ok := m.redirectMap[originalURL]; ok {
+		header := http.Header{}
+		header.Set("Location", locationURL)
+		return &http.Response{StatusCode: http.StatusFound, Header: header, Body: io.NopCloser(bytes.NewBufferString("")), Request: req}, nil
+	}
+
+	if code, ok := m.statuses[originalURL]; ok && req.Method == http.MethodGet {
+		return &http.Response{StatusCode: code, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString("")), Request: req}, nil
+	}
+
+	if page, ok := m.pages[originalURL]; ok {
+		body := ""
+		if req.Method == http.MethodGet {
+			body = page
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}
+
+	return nil, http.ErrHandlerTimeout
+}
+
+// readFixture returns a recorded page from testdata
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	page, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return string(page)
+}
+
+func TestExtractCoordinatesFromPage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fixture       string
+		expectLat     float64
+		expectLon     float64
+		expectZoom    int
+		expectPattern string
+		errContains   string
+	}{
+		{
+			name:          "Static map preview image, preferred over the viewport",
+			fixture:       "place_og_image.html",
+			expectLat:     55.1677806,
+			expectLon:     -6.8108972,
+			expectZoom:    16,
+			expectPattern: "og_image",
+		},
+		{
+			name:          "Initial map state",
+			fixture:       "place_app_state.html",
+			expectLat:     35.6594945,
+			expectLon:     139.7005713,
+			expectPattern: "app_state",
+		},
+		{
+			name:          "Place meta tags",
+			fixture:       "place_meta.html",
+			expectLat:     -33.8567844,
+			expectLon:     151.2152967,
+			expectPattern: "meta",
+		},
+		{
+			name:        "Page without coordinates",
+			fixture:     "no_coordinates.html",
+			errContains: "no coordinates found in page",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+
+			shortURL := "https://maps.app.goo.gl/PageFallback"
+			placeURL := "https://www.google.com/maps/place/Somewhere/data=!4m2!3m1!1s0x0:0x0?entry=tts"
+			mockClient := &mockPageHTTPClient{
+				redirectMap: map[string]string{shortURL: placeURL},
+				pages:       map[string]string{placeURL: readFixture(t, tc.fixture)},
+			}
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+			before := testutil.ToFloat64(metrics.Conversions.WithLabelValues("redirect", tc.expectPattern, "success"))
+			coords, err := extractor.ExtractCoordinates(context.Background(), shortURL)
+
+			if tc.errContains != "" {
+				assert.ErrorContains(t, err, tc.errContains)
+				assert.ErrorContains(t, err, shortURL+" -> "+placeURL)
+				assert.Nil(t, coords)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, coords)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+			assert.Equal(t, tc.expectZoom, coords.Zoom)
+			assert.Equal(t, before+1, testutil.ToFloat64(metrics.Conversions.WithLabelValues("redirect", tc.expectPattern, "success")))
+		})
+	}
+}
+
+func TestExtractCoordinatesFromPageFailures(t *testing.T) {
+	testCases := []struct {
+		name        string
+		status      int
+		errContains string
+	}{
+		{
+			name:        "Throttled",
+			status:      http.StatusTooManyRequests,
+			errContains: "www.google.com is throttling requests, try again later: status 429",
+		},
+		{
+			name:        "Not found",
+			status:      http.StatusNotFound,
+			errContains: "failed to fetch page: status 404",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+
+			placeURL := "https://www.google.com/maps/place/Somewhere"
+			mockClient := &mockPageHTTPClient{
+				pages:    map[string]string{placeURL: ""},
+				statuses: map[string]int{placeURL: tc.status},
+			}
+			extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), placeURL)
+			assert.ErrorContains(t, err, tc.errContains)
+			assert.Nil(t, coords)
+		})
+	}
+}
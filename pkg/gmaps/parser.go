@@ -16,23 +16,8 @@ var (
 	mapsAppGooGlRegex = regexp.MustCompile(`https?://maps\.app\.goo\.gl/[^\s<>"]*`)
 )
 
-// ExtractGoogleMapsURLs finds all Google Maps URLs in the given text
-func ExtractGoogleMapsURLs(text string) []string {
-	urls := make([]string, 0)
-
-	// Check for regular Google Maps URLs
-	matches := googleMapsRegex.FindAllString(text, -1)
-	urls = append(urls, matches...)
-
-	// Check for goo.gl/maps shortened URLs
-	matches = gooGlMapsRegex.FindAllString(text, -1)
-	urls = append(urls, matches...)
-
-	// Check for maps.app.goo.gl shortened URLs
-	matches = mapsAppGooGlRegex.FindAllString(text, -1)
-	urls = append(urls, matches...)
-
-	// Deduplicate
+// deduplicate removes repeated URLs, keeping the first occurrence of each
+func deduplicate(urls []string) []string {
 	seen := make(map[string]bool)
 	result := make([]string, 0)
 	for _, url := range urls {
@@ -7,7 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestExtractGoogleMapsURLs(t *testing.T) {
+func TestExtractMapURLsFindsGoogleMapsLinks(t *testing.T) {
 	testCases := []struct {
 		name     string
 		text     string
@@ -80,7 +80,7 @@ func TestExtractGoogleMapsURLs(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := gmaps.ExtractGoogleMapsURLs(tc.text)
+			result := gmaps.ExtractMapURLs(tc.text)
 			assert.ElementsMatch(t, tc.expected, result, "URLs should match")
 		})
 	}
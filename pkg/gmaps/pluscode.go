@@ -0,0 +1,275 @@
+package gmaps
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Open Location Code (plus code) parameters, see https://github.com/google/open-location-code
+const (
+	plusCodeAlphabet  = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator = '+'
+	plusCodePadding   = '0'
+
+	// plusCodeSeparatorPosition is the number of digits before the separator in a full code
+	plusCodeSeparatorPosition = 8
+
+	// plusCodePairLength is the number of digits encoded as latitude and longitude pairs, after
+	// which each digit refines a grid of plusCodeGridRows by plusCodeGridColumns
+	plusCodePairLength  = 10
+	plusCodeMaxLength   = 15
+	plusCodeGridRows    = 5
+	plusCodeGridColumns = 4
+
+	// PlusCodeLength is the length of the plus codes encoded for replies, an area about 14m across
+	PlusCodeLength = 10
+)
+
+// Plus codes in links and text
+var (
+	// Full plus codes, like 9C3XGV4C+XV
+	fullPlusCodeRegex = regexp.MustCompile(`[23456789CFGHJMPQRVWX]{8}\+[23456789CFGHJMPQRVWX]{2,7}`)
+
+	// Short plus codes followed by their locality, like GV4C+XV London or GV4C+XV Paris, France
+	shortPlusCodeRegex = regexp.MustCompile(`[23456789CFGHJMPQRVWX]{4,6}\+[23456789CFGHJMPQRVWX]{2,7}(?:,?[ \t]+\p{Lu}[\p{L}'’-]*)+`)
+
+	// Plus codes starting a Google Maps search or place, where + may have been decoded to a space
+	plusCodePrefixRegex = regexp.MustCompile(`^([23456789CFGHJMPQRVWX]{2,8})[+ ]([23456789CFGHJMPQRVWX]{2,7})`)
+)
+
+// plusCodeDigit returns the value of a plus code digit, or -1 if it isn't one
+func plusCodeDigit(c byte) int {
+	return strings.IndexByte(plusCodeAlphabet, c)
+}
+
+// IsValidPlusCode reports whether code is a full or short plus code
+func IsValidPlusCode(code string) bool {
+	code = strings.ToUpper(code)
+
+	separator := strings.IndexByte(code, plusCodeSeparator)
+	if separator < 0 || separator != strings.LastIndexByte(code, plusCodeSeparator) ||
+		separator > plusCodeSeparatorPosition || separator%2 != 0 {
+		return false
+	}
+
+	// Padded codes, like 8FVC0000+, stop at the padding
+	if padding := strings.IndexByte(code, plusCodePadding); padding >= 0 {
+		if padding == 0 || padding%2 != 0 || separator != plusCodeSeparatorPosition || separator != len(code)-1 {
+			return false
+		}
+		if strings.Trim(code[padding:separator], string(plusCodePadding)) != "" {
+			return false
+		}
+		code = code[:padding]
+	}
+
+	// A single digit after the separator isn't allowed
+	if len(code)-separator-1 == 1 {
+		return false
+	}
+
+	for i := range len(code) {
+		if i != separator && plusCodeDigit(code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsFullPlusCode reports whether code is a plus code which can be decoded without a reference point
+func IsFullPlusCode(code string) bool {
+	if !IsValidPlusCode(code) || strings.IndexByte(code, plusCodeSeparator) != plusCodeSeparatorPosition {
+		return false
+	}
+
+	// The first pair of digits mustn't go past 90° latitude or 180° longitude
+	code = strings.ToUpper(code)
+	return plusCodeDigit(code[0])*20 < 180 && plusCodeDigit(code[1])*20 < 360
+}
+
+// IsShortPlusCode reports whether code is a plus code with leading digits left out, which needs a
+// reference point to decode
+func IsShortPlusCode(code string) bool {
+	return IsValidPlusCode(code) && strings.IndexByte(code, plusCodeSeparator) < plusCodeSeparatorPosition
+}
+
+// DecodePlusCode returns the centre of the area a full plus code describes
+func DecodePlusCode(code string) (*Coordinates, error) {
+	if !IsFullPlusCode(code) {
+		return nil, fmt.Errorf("not a full plus code: %q", code)
+	}
+
+	lat, lon, latSize, lonSize := decodePlusCodeArea(code)
+	return &Coordinates{
+		Latitude:  math.Min(lat+latSize/2, 90),
+		Longitude: math.Min(lon+lonSize/2, 180),
+	}, nil
+}
+
+// decodePlusCodeArea returns the south west corner and size of the area a full plus code describes
+func decodePlusCodeArea(code string) (lat, lon, latSize, lonSize float64) {
+	digits := strings.ToUpper(strings.Replace(code, string(plusCodeSeparator), "", 1))
+	digits, _, _ = strings.Cut(digits, string(plusCodePadding))
+	digits = digits[:min(len(digits), plusCodeMaxLength)]
+
+	lat, lon = -90, -180
+	latSize, lonSize = 400, 400
+	for i := 0; i < len(digits) && i < plusCodePairLength; i += 2 {
+		latSize /= 20
+		lonSize /= 20
+		lat += float64(plusCodeDigit(digits[i])) * latSize
+		lon += float64(plusCodeDigit(digits[i+1])) * lonSize
+	}
+	for i := plusCodePairLength; i < len(digits); i++ {
+		latSize /= plusCodeGridRows
+		lonSize /= plusCodeGridColumns
+		digit := plusCodeDigit(digits[i])
+		lat += float64(digit/plusCodeGridColumns) * latSize
+		lon += float64(digit%plusCodeGridColumns) * lonSize
+	}
+	return lat, lon, latSize, lonSize
+}
+
+// RecoverPlusCode returns the full plus code nearest to the reference point that shortCode could
+// have been shortened from. Full codes are returned as they are
+func RecoverPlusCode(shortCode string, refLat, refLon float64) (string, error) {
+	if IsFullPlusCode(shortCode) {
+		return strings.ToUpper(shortCode), nil
+	}
+	if !IsShortPlusCode(shortCode) {
+		return "", fmt.Errorf("not a plus code: %q", shortCode)
+	}
+
+	refLat = math.Max(-90, math.Min(90, refLat))
+	refLon = normaliseLongitude(refLon)
+
+	// Take the missing digits from the reference point, then move the area by a whole cell of
+	// the missing digits' resolution if that brings it closer to the reference point
+	missing := plusCodeSeparatorPosition - strings.IndexByte(shortCode, plusCodeSeparator)
+	resolution := math.Pow(20, float64(2-missing/2))
+
+	code := encodePlusCode(refLat, refLon, plusCodePairLength)[:missing] + strings.ToUpper(shortCode)
+	lat, lon, latSize, lonSize := decodePlusCodeArea(code)
+	lat, lon = lat+latSize/2, lon+lonSize/2
+
+	switch {
+	case refLat+resolution/2 < lat && lat-resolution >= -90:
+		lat -= resolution
+	case refLat-resolution/2 > lat && lat+resolution <= 90:
+		lat += resolution
+	}
+	switch {
+	case refLon+resolution/2 < lon:
+		lon -= resolution
+	case refLon-resolution/2 > lon:
+		lon += resolution
+	}
+
+	return encodePlusCode(lat, lon, len(code)-1), nil
+}
+
+// EncodePlusCode returns the plus code of the PlusCodeLength area containing the coordinates
+func EncodePlusCode(lat, lon float64) string {
+	return encodePlusCode(lat, lon, PlusCodeLength)
+}
+
+// encodePlusCode returns the plus code with length digits, from 10 to 15, of the area containing lat, lon
+func encodePlusCode(lat, lon float64, length int) string {
+	// Work in integer steps of the most precise grid, rounding away floating point error first
+	latSteps := 8000 * math.Pow(plusCodeGridRows, plusCodeMaxLength-plusCodePairLength)
+	lonSteps := 8000 * math.Pow(plusCodeGridColumns, plusCodeMaxLength-plusCodePairLength)
+	latValue := int64(math.Floor(math.Round((math.Max(-90, math.Min(90, lat))+90)*latSteps*1e6) / 1e6))
+	lonValue := int64(math.Floor(math.Round((normaliseLongitude(lon)+180)*lonSteps*1e6) / 1e6))
+
+	// The north pole is in the row below it
+	latValue = min(latValue, int64(180*latSteps)-1)
+
+	digits := make([]byte, plusCodeMaxLength)
+	for i := plusCodeMaxLength - 1; i >= plusCodePairLength; i-- {
+		digits[i] = plusCodeAlphabet[(latValue%plusCodeGridRows)*plusCodeGridColumns+lonValue%plusCodeGridColumns]
+		latValue /= plusCodeGridRows
+		lonValue /= plusCodeGridColumns
+	}
+	for i := plusCodePairLength - 2; i >= 0; i -= 2 {
+		digits[i] = plusCodeAlphabet[latValue%20]
+		digits[i+1] = plusCodeAlphabet[lonValue%20]
+		latValue /= 20
+		lonValue /= 20
+	}
+
+	length = max(plusCodePairLength, min(length, plusCodeMaxLength))
+	return string(digits[:plusCodeSeparatorPosition]) + string(plusCodeSeparator) + string(digits[plusCodeSeparatorPosition:length])
+}
+
+// normaliseLongitude wraps lon into [-180, 180)
+func normaliseLongitude(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon >= 180 {
+		lon -= 360
+	}
+	return lon
+}
+
+// parsePlusCodeURL decodes a plus code Google Maps searched for or placed, like /maps/search/GV4C%2BXV
+// or ?q=9C3XGV4C%2BXV. Short codes are recovered near the URL's @lat,lon viewport, if it has one
+func parsePlusCodeURL(u *url.URL, urlStr string) (*Coordinates, error) {
+	code := plusCodeInURL(u)
+	if code == "" {
+		return nil, fmt.Errorf("no plus code found in URL")
+	}
+
+	if IsShortPlusCode(code) {
+		match := atCoordRegex.FindStringSubmatch(urlStr)
+		if match == nil {
+			return nil, fmt.Errorf("short plus code %s without a reference point", code)
+		}
+		ref, err := parseCoordMatch(match[1], match[2])
+		if err != nil {
+			return nil, err
+		}
+		if code, err = RecoverPlusCode(code, ref.Latitude, ref.Longitude); err != nil {
+			return nil, err
+		}
+	}
+
+	return DecodePlusCode(code)
+}
+
+// plusCodeInURL returns the plus code at the start of a Google Maps search or place, or ""
+func plusCodeInURL(u *url.URL) string {
+	candidates := []string{u.Query().Get("q"), u.Query().Get("query")}
+
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		if segment == "search" || segment == "place" {
+			candidates = append(candidates, segments[i+1])
+		}
+	}
+
+	for _, candidate := range candidates {
+		match := plusCodePrefixRegex.FindStringSubmatch(candidate)
+		if match == nil {
+			continue
+		}
+		if code := match[1] + string(plusCodeSeparator) + match[2]; IsValidPlusCode(code) {
+			return code
+		}
+	}
+	return ""
+}
+
+// shortPlusCodeSearchURL returns the Google Maps search for a short plus code written with its
+// locality, like GV4C+XV London, which can't be decoded without looking up where the locality is
+func shortPlusCodeSearchURL(text string) (string, bool) {
+	if loc := shortPlusCodeRegex.FindStringIndex(text); loc == nil || loc[0] != 0 || loc[1] != len(text) {
+		return "", false
+	}
+	// Google Maps reads + in a search as a space, so the code's own + is escaped
+	search := strings.ReplaceAll(strings.ReplaceAll(url.PathEscape(text), "+", "%2B"), "%20", "+")
+	return "https://www.google.com/maps/search/" + search, true
+}
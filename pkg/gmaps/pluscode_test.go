@@ -0,0 +1,190 @@
+package gmaps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPlusCodeValidity(t *testing.T) {
+	testCases := []struct {
+		code  string
+		valid bool
+		full  bool
+		short bool
+	}{
+		{code: "9C3XGV4C+XV", valid: true, full: true},
+		{code: "9c3xgv4c+xv", valid: true, full: true},
+		{code: "8FVC9G8F+6XQ", valid: true, full: true},
+		{code: "8FVC0000+", valid: true, full: true},
+		{code: "GV4C+XV", valid: true, short: true},
+		{code: "4C+XV", valid: true, short: true},
+		{code: "9C3XGV4C", valid: false},
+		{code: "9C3XGV4C+X", valid: false},
+		{code: "9C3XGV4+CXV", valid: false},
+		{code: "9C3XGV4C+XV+", valid: false},
+		{code: "8FVC0000+9G", valid: false},
+		{code: "8FV00000+", valid: false},
+		{code: "9A3XGV4C+XV", valid: false},
+		{code: "X23XGV4C+XV", valid: true, full: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			assert.Equal(t, tc.valid, gmaps.IsValidPlusCode(tc.code), "valid")
+			assert.Equal(t, tc.full, gmaps.IsFullPlusCode(tc.code), "full")
+			assert.Equal(t, tc.short, gmaps.IsShortPlusCode(tc.code), "short")
+		})
+	}
+}
+
+func TestDecodePlusCode(t *testing.T) {
+	testCases := []struct {
+		code      string
+		expectLat float64
+		expectLon float64
+	}{
+		{code: "8FW4V75V+8Q", expectLat: 48.858313, expectLon: 2.294438},
+		{code: "9C3XGV4C+XV", expectLat: 51.507438, expectLon: -0.127813},
+		{code: "9C3XGV4C+XVQ", expectLat: 51.507488, expectLon: -0.127797},
+		{code: "8FVC0000+", expectLat: 47.5, expectLon: 8.5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			coords, err := gmaps.DecodePlusCode(tc.code)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001)
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001)
+		})
+	}
+
+	_, err := gmaps.DecodePlusCode("GV4C+XV")
+	assert.Error(t, err, "Short codes need a reference point")
+}
+
+func TestEncodePlusCode(t *testing.T) {
+	assert.Equal(t, "9C3XGV4C+XV", gmaps.EncodePlusCode(51.5074, -0.1278))
+	assert.Equal(t, "8FW4V75V+8Q", gmaps.EncodePlusCode(48.8583, 2.2944))
+	assert.Equal(t, "C2X2X2X2+X2", gmaps.EncodePlusCode(90, 180), "The north pole and antimeridian wrap into range")
+
+	for _, code := range []string{"9C3XGV4C+XV", "8FW4V75V+8Q", "7FG49QCJ+2V"} {
+		coords, err := gmaps.DecodePlusCode(code)
+		require.NoError(t, err)
+		assert.Equal(t, code, gmaps.EncodePlusCode(coords.Latitude, coords.Longitude), "Round trip of %s", code)
+	}
+}
+
+func TestRecoverPlusCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		code     string
+		refLat   float64
+		refLon   float64
+		expected string
+	}{
+		{name: "Nearby reference", code: "GV4C+XV", refLat: 51.5, refLon: -0.12, expected: "9C3XGV4C+XV"},
+		{name: "Reference across a cell boundary", code: "GV4C+XV", refLat: 52.001, refLon: -0.12, expected: "9C3XGV4C+XV"},
+		{name: "Reference across the prime meridian", code: "GV4C+XV", refLat: 51.5, refLon: 0.01, expected: "9C3XGV4C+XV"},
+		{name: "Fewer digits left out", code: "3XGV4C+XV", refLat: 51.5, refLon: -0.12, expected: "9C3XGV4C+XV"},
+		{name: "Full codes are unchanged", code: "8fw4v75v+8q", refLat: 0, refLon: 0, expected: "8FW4V75V+8Q"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recovered, err := gmaps.RecoverPlusCode(tc.code, tc.refLat, tc.refLon)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, recovered)
+		})
+	}
+
+	_, err := gmaps.RecoverPlusCode("GV4C", 51.5, -0.12)
+	assert.Error(t, err)
+}
+
+func TestExtractCoordinatesFromPlusCodes(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expectLat float64
+		expectLon float64
+	}{
+		{
+			name:      "Full code search",
+			input:     "https://www.google.com/maps/search/9C3XGV4C%2BXV",
+			expectLat: 51.507438,
+			expectLon: -0.127813,
+		},
+		{
+			name:      "Short code place with the viewport as reference",
+			input:     "https://www.google.com/maps/place/GV4C%2BXV+London/@51.5,-0.12,15z",
+			expectLat: 51.507438,
+			expectLon: -0.127813,
+		},
+		{
+			name:      "Full code query",
+			input:     "https://maps.google.com/?q=8FW4V75V%2B8Q",
+			expectLat: 48.858313,
+			expectLon: 2.294438,
+		},
+		{
+			name:      "Full code in text",
+			input:     "8FW4V75V+8Q",
+			expectLat: 48.858313,
+			expectLon: 2.294438,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.input)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+		})
+	}
+}
+
+func TestShortPlusCodeInTextIsSearchedFor(t *testing.T) {
+	assert.Equal(t, []string{"GV4C+XV London", "9C3XGV4C+XV"}, gmaps.ExtractTextCoordinates("Meet at GV4C+XV London or 9C3XGV4C+XV, but not GV4C+XV alone"))
+
+	logger := zaptest.NewLogger(t).Sugar()
+	mockClient := &mockRedirectHTTPClient{redirectMap: map[string]string{
+		"https://www.google.com/maps/search/GV4C%2BXV+London": "https://www.google.com/maps/place/London/@51.507438,-0.127813,17z",
+	}}
+	extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+	coords, err := extractor.ExtractCoordinates(context.Background(), "GV4C+XV London")
+	require.NoError(t, err)
+	assert.InDelta(t, 51.507438, coords.Latitude, 0.0001)
+	assert.InDelta(t, -0.127813, coords.Longitude, 0.0001)
+}
+
+func TestPlusCodesReachedByRedirectAreWGS84(t *testing.T) {
+	expected, err := gmaps.DecodePlusCode("8PFRW9X7+2M")
+	require.NoError(t, err)
+
+	logger := zaptest.NewLogger(t).Sugar()
+	mockClient := &mockRedirectHTTPClient{redirectMap: map[string]string{
+		"https://maps.app.goo.gl/Beijing":                      "https://www.google.com/maps/search/8PFRW9X7%2B2M",
+		"https://www.google.com/maps/search/W9X7%2B2M+Beijing": "https://www.google.com/maps/search/8PFRW9X7%2B2M",
+	}}
+	extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+	for _, input := range []string{"8PFRW9X7+2M", "https://maps.app.goo.gl/Beijing", "W9X7+2M Beijing"} {
+		t.Run(input, func(t *testing.T) {
+			coords, err := extractor.ExtractCoordinates(context.Background(), input)
+			require.NoError(t, err)
+			assert.Equal(t, gmaps.WGS84, coords.Datum, "Plus codes aren't in Google's datum, however they arrive")
+			assert.InDelta(t, expected.Latitude, coords.Latitude, 1e-9)
+			assert.InDelta(t, expected.Longitude, coords.Longitude, 1e-9)
+		})
+	}
+}
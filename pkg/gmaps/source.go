@@ -0,0 +1,153 @@
+package gmaps
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+)
+
+// Source is a map service whose links can be converted
+type Source interface {
+	// Name is how the service is shown in replies, e.g. "Google Maps"
+	Name() string
+
+	// FindURLs returns the links to the service in text
+	FindURLs(text string) []string
+
+	// ParseURL extracts coordinates from a link to the service without fetching it. It also
+	// returns the name of the pattern that matched, even if the coordinates were invalid
+	ParseURL(urlStr string) (*Coordinates, string, error)
+
+	// Datum returns the datum the service's coordinates at lat, lon are in
+	Datum(lat, lon float64) Datum
+}
+
+// regexSource is a Source whose links are found with regular expressions
+type regexSource struct {
+	name    string
+	regexes []*regexp.Regexp
+	parse   func(u *url.URL) (*Coordinates, string, error)
+	datum   func(lat, lon float64) Datum
+}
+
+func (s regexSource) Name() string { return s.name }
+
+func (s regexSource) Datum(lat, lon float64) Datum { return s.datum(lat, lon) }
+
+func (s regexSource) FindURLs(text string) []string {
+	urls := make([]string, 0)
+	for _, regex := range s.regexes {
+		urls = append(urls, regex.FindAllString(text, -1)...)
+	}
+	return urls
+}
+
+func (s regexSource) ParseURL(urlStr string) (*Coordinates, string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, patternNone, fmt.Errorf("invalid URL: %w", err)
+	}
+	return s.parse(parsedURL)
+}
+
+// googleMapsSource is the source the bot was written for, and the fallback for links no source claims.
+// Its patterns match the URL as shared, so it's parsed without being re-encoded
+type googleMapsSource struct {
+	regexSource
+}
+
+func (s googleMapsSource) ParseURL(urlStr string) (*Coordinates, string, error) {
+	return parseGoogleMapsURL(urlStr)
+}
+
+var googleMaps = googleMapsSource{regexSource{
+	name:    "Google Maps",
+	regexes: []*regexp.Regexp{googleMapsRegex, gooGlMapsRegex, mapsAppGooGlRegex},
+	datum:   gcj02InChina,
+}}
+
+// gcj02InChina is the datum of services which follow Chinese regulations, using GCJ-02 in mainland China
+func gcj02InChina(lat, lon float64) Datum {
+	if InMainlandChina(lat, lon) {
+		return GCJ02
+	}
+	return WGS84
+}
+
+// alwaysWGS84 is the datum of services which use WGS-84 everywhere, including mainland China
+func alwaysWGS84(lat, lon float64) Datum {
+	return WGS84
+}
+
+// sources holds the registered sources, in the order links are looked for
+var sources []Source
+
+func init() {
+	RegisterSource(googleMaps)
+	// Apple's maps of mainland China come from a local provider, so are GCJ-02 like Google's
+	RegisterSource(regexSource{"Apple Maps", []*regexp.Regexp{appleMapsRegex}, parseAppleMapsURL, gcj02InChina})
+	RegisterSource(regexSource{"Bing Maps", []*regexp.Regexp{bingMapsRegex}, parseBingMapsURL, alwaysWGS84})
+	RegisterSource(regexSource{"HERE WeGo", []*regexp.Regexp{hereWeGoRegex}, parseHereWeGoURL, alwaysWGS84})
+	RegisterSource(regexSource{"Waze", []*regexp.Regexp{wazeRegex}, parseWazeURL, alwaysWGS84})
+	RegisterSource(regexSource{"Yandex Maps", []*regexp.Regexp{yandexMapsRegex}, parseYandexMapsURL, alwaysWGS84})
+	RegisterSource(textCoordinatesSource{})
+}
+
+// RegisterSource adds a source to the registry, replacing any existing source with the same name
+func RegisterSource(s Source) {
+	if i := slices.IndexFunc(sources, func(existing Source) bool { return existing.Name() == s.Name() }); i >= 0 {
+		sources[i] = s
+		return
+	}
+	sources = append(sources, s)
+}
+
+// Sources returns the registered sources, in the order links are looked for
+func Sources() []Source {
+	return slices.Clone(sources)
+}
+
+// SourceOf returns the source the whole of urlStr links to, or nil if there isn't one
+func SourceOf(urlStr string) Source {
+	for _, s := range sources {
+		if slices.Contains(s.FindURLs(urlStr), urlStr) {
+			return s
+		}
+	}
+	return nil
+}
+
+// IsMapURL reports whether the whole of urlStr is a link to a registered source
+func IsMapURL(urlStr string) bool {
+	return SourceOf(urlStr) != nil
+}
+
+// ExtractMapURLs finds the links to every registered source in the given text
+func ExtractMapURLs(text string) []string {
+	urls := make([]string, 0)
+	for _, s := range sources {
+		urls = append(urls, s.FindURLs(text)...)
+	}
+	return deduplicate(urls)
+}
+
+// sourceOrGoogleMaps returns the source urlStr links to. Links no source claims, such as redirects
+// to unfamiliar hosts, are treated as Google Maps links
+func sourceOrGoogleMaps(urlStr string) Source {
+	if s := SourceOf(urlStr); s != nil {
+		return s
+	}
+	return googleMaps
+}
+
+// parseCoordinatesFromURL extracts coordinates from urlStr with the parser of the source it links
+// to, marking them with the datum the source uses there
+func (e *Extractor) parseCoordinatesFromURL(urlStr string) (*Coordinates, string, error) {
+	s := sourceOrGoogleMaps(urlStr)
+	coords, pattern, err := s.ParseURL(urlStr)
+	if err != nil {
+		return nil, pattern, err
+	}
+	return markDatum(coords, pattern, s), pattern, nil
+}
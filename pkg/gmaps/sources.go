@@ -0,0 +1,208 @@
+package gmaps
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Links to map services other than Google Maps
+var (
+	// Apple Maps links and maps.apple short links
+	appleMapsRegex = regexp.MustCompile(`https?://maps\.apple(?:\.com)?/[^\s<>"]*`)
+
+	// Bing Maps links
+	bingMapsRegex = regexp.MustCompile(`https?://(?:www\.)?bing\.com/maps(?:[/?][^\s<>"]*)?`)
+
+	// HERE WeGo links and share.here.com short links
+	hereWeGoRegex = regexp.MustCompile(`https?://(?:wego|share)\.here\.com/[^\s<>"]*`)
+
+	// Waze universal links and live map links, optionally with a language
+	wazeRegex = regexp.MustCompile(`https?://(?:www\.)?waze\.com/(?:[a-z]{2}(?:-[A-Za-z]{2})?/)?(?:ul|live-map)(?:[/?][^\s<>"]*)?`)
+
+	// Yandex Maps links on its regional domains
+	yandexMapsRegex = regexp.MustCompile(`https?://(?:www\.)?yandex\.(?:ru|com|com\.tr|by|kz|uz|ua)/maps(?:[/?][^\s<>"]*)?`)
+)
+
+// parseAppleMapsURL extracts coordinates from an Apple Maps link, preferring the place or pin
+// over the search location. q and daddr are often addresses rather than coordinates
+func parseAppleMapsURL(u *url.URL) (*Coordinates, string, error) {
+	query := u.Query()
+
+	for _, param := range []string{"coordinate", "ll", "q", "daddr", "sll"} {
+		coords, err := parseCoordPair(query.Get(param), ",", false)
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("z"))
+			return coords, "apple_" + param, nil
+		}
+	}
+
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
+}
+
+// parseBingMapsURL extracts coordinates from a Bing Maps link, preferring a pushpin in sp, like
+// point.47.6062_-122.3321_Seattle, over the map centre in cp, like 47.6062~-122.3321
+func parseBingMapsURL(u *url.URL) (*Coordinates, string, error) {
+	query := u.Query()
+
+	// Several pushpins are separated by ~, the first is used
+	if point, ok := strings.CutPrefix(query.Get("sp"), "point."); ok {
+		point, _, _ = strings.Cut(point, "~")
+		if coords, err := parseCoordPair(point, "_", false); err == nil {
+			coords.Zoom = parseZoom(query.Get("lvl"))
+			return coords, "bing_sp", nil
+		}
+	}
+
+	if cp := query.Get("cp"); cp != "" {
+		coords, err := parseCoordPair(cp, "~", false)
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("lvl"))
+		}
+		return coords, "bing_cp", err
+	}
+
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
+}
+
+// parseHereWeGoURL extracts coordinates from a HERE WeGo link, either the map parameter, like
+// 52.5308,13.3847,15,normal, or a share.here.com/l/52.5308,13.3847,Name location
+func parseHereWeGoURL(u *url.URL) (*Coordinates, string, error) {
+	if mapParam := u.Query().Get("map"); mapParam != "" {
+		coords, err := parseCoordPair(mapParam, ",", false)
+		if fields := strings.Split(mapParam, ","); err == nil && len(fields) > 2 {
+			coords.Zoom = parseZoom(fields[2])
+		}
+		return coords, "here_map", err
+	}
+
+	if location, ok := strings.CutPrefix(u.Path, "/l/"); ok {
+		coords, err := parseCoordPair(location, ",", false)
+		return coords, "here_location", err
+	}
+
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
+}
+
+// parseWazeURL extracts coordinates from a Waze link, from its ll or latlng parameter, a live map
+// destination like to=ll.45.6906,-120.8109, or a geohash short link like waze.com/ul/hgcpvj0dyd
+func parseWazeURL(u *url.URL) (*Coordinates, string, error) {
+	query := u.Query()
+	zoom := parseZoom(query.Get("zoom"))
+
+	for _, param := range []string{"ll", "latlng"} {
+		if value := query.Get(param); value != "" {
+			coords, err := parseCoordPair(value, ",", false)
+			if err == nil {
+				coords.Zoom = zoom
+			}
+			return coords, "waze_" + param, err
+		}
+	}
+
+	if to, ok := strings.CutPrefix(query.Get("to"), "ll."); ok {
+		coords, err := parseCoordPair(to, ",", false)
+		if err == nil {
+			coords.Zoom = zoom
+		}
+		return coords, "waze_to", err
+	}
+
+	if geohash, ok := strings.CutPrefix(strings.TrimSuffix(u.Path, "/"), "/ul/h"); ok {
+		coords, err := decodeGeohash(geohash)
+		return coords, "waze_geohash", err
+	}
+
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
+}
+
+// parseYandexMapsURL extracts coordinates from a Yandex Maps link, preferring a placemark in pt,
+// then a "what's here" point, then the map centre in ll. Yandex puts the longitude first
+func parseYandexMapsURL(u *url.URL) (*Coordinates, string, error) {
+	query := u.Query()
+
+	// Several placemarks are separated by ~, each optionally followed by its style, the first is used
+	if pt := query.Get("pt"); pt != "" {
+		pt, _, _ = strings.Cut(pt, "~")
+		coords, err := parseCoordPair(pt, ",", true)
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("z"))
+		}
+		return coords, "yandex_pt", err
+	}
+
+	if point := query.Get("whatshere[point]"); point != "" {
+		coords, err := parseCoordPair(point, ",", true)
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("whatshere[zoom]"))
+		}
+		return coords, "yandex_whatshere", err
+	}
+
+	if ll := query.Get("ll"); ll != "" {
+		coords, err := parseCoordPair(ll, ",", true)
+		if err == nil {
+			coords.Zoom = parseZoom(query.Get("z"))
+		}
+		return coords, "yandex_ll", err
+	}
+
+	return nil, patternNone, fmt.Errorf("no coordinates found in URL")
+}
+
+// parseCoordPair parses the first two sep-separated fields of value as latitude then longitude,
+// or longitude then latitude if lonFirst is set. Any further fields are ignored
+func parseCoordPair(value string, sep string, lonFirst bool) (*Coordinates, error) {
+	fields := strings.Split(value, sep)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("expected coordinates separated by %q, got %q", sep, value)
+	}
+
+	first, second := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+	if lonFirst {
+		return parseCoordMatch(second, first)
+	}
+	return parseCoordMatch(first, second)
+}
+
+// geohashAlphabet is the base 32 alphabet geohashes are written in
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// decodeGeohash returns the centre of the cell a geohash describes. Each character holds 5 bits
+// which alternately halve the longitude and latitude ranges, starting with longitude
+func decodeGeohash(geohash string) (*Coordinates, error) {
+	if geohash == "" {
+		return nil, fmt.Errorf("empty geohash")
+	}
+
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+
+	for _, c := range strings.ToLower(geohash) {
+		bits := strings.IndexRune(geohashAlphabet, c)
+		if bits < 0 {
+			return nil, fmt.Errorf("invalid geohash character %q", c)
+		}
+
+		for mask := 16; mask > 0; mask >>= 1 {
+			r := &latRange
+			if even {
+				r = &lonRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if bits&mask != 0 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+
+	return &Coordinates{
+		Latitude:  (latRange[0] + latRange[1]) / 2,
+		Longitude: (lonRange[0] + lonRange[1]) / 2,
+	}, nil
+}
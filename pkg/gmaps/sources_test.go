@@ -0,0 +1,205 @@
+package gmaps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExtractCoordinatesFromOtherSources(t *testing.T) {
+	testCases := []struct {
+		name         string
+		url          string
+		expectSource string
+		expectLat    float64
+		expectLon    float64
+		expectZoom   int
+	}{
+		{
+			name:         "Apple Maps pin with a name",
+			url:          "https://maps.apple.com/?ll=50.894967,4.341626&q=Atomium&z=16",
+			expectSource: "Apple Maps",
+			expectLat:    50.894967,
+			expectLon:    4.341626,
+			expectZoom:   16,
+		},
+		{
+			name:         "Apple Maps coordinates query",
+			url:          "https://maps.apple.com/?q=48.8584,2.2945",
+			expectSource: "Apple Maps",
+			expectLat:    48.8584,
+			expectLon:    2.2945,
+		},
+		{
+			name:         "Apple Maps place",
+			url:          "https://maps.apple.com/place?coordinate=37.3349,-122.0090&name=Apple%20Park",
+			expectSource: "Apple Maps",
+			expectLat:    37.3349,
+			expectLon:    -122.0090,
+		},
+		{
+			name:         "Bing Maps centre",
+			url:          "https://www.bing.com/maps?cp=47.6062~-122.3321&lvl=11",
+			expectSource: "Bing Maps",
+			expectLat:    47.6062,
+			expectLon:    -122.3321,
+			expectZoom:   11,
+		},
+		{
+			name:         "Bing Maps pushpin preferred over centre",
+			url:          "https://bing.com/maps/default.aspx?cp=47.6~-122.3&sp=point.47.6205_-122.3493_Space%20Needle&lvl=15",
+			expectSource: "Bing Maps",
+			expectLat:    47.6205,
+			expectLon:    -122.3493,
+			expectZoom:   15,
+		},
+		{
+			name:         "HERE WeGo map",
+			url:          "https://wego.here.com/?map=52.5308,13.3847,15,normal",
+			expectSource: "HERE WeGo",
+			expectLat:    52.5308,
+			expectLon:    13.3847,
+			expectZoom:   15,
+		},
+		{
+			name:         "HERE share location",
+			url:          "https://share.here.com/l/52.5163,13.3777,Brandenburg%20Gate",
+			expectSource: "HERE WeGo",
+			expectLat:    52.5163,
+			expectLon:    13.3777,
+		},
+		{
+			name:         "Waze universal link",
+			url:          "https://www.waze.com/ul?ll=45.6906304,-120.810983&navigate=yes&zoom=17",
+			expectSource: "Waze",
+			expectLat:    45.6906304,
+			expectLon:    -120.810983,
+			expectZoom:   17,
+		},
+		{
+			name:         "Waze live map destination",
+			url:          "https://www.waze.com/en-GB/live-map/directions?to=ll.51.5074,-0.1278",
+			expectSource: "Waze",
+			expectLat:    51.5074,
+			expectLon:    -0.1278,
+		},
+		{
+			name:         "Waze geohash short link",
+			url:          "https://waze.com/ul/hu4pruydqqvj",
+			expectSource: "Waze",
+			expectLat:    57.64911,
+			expectLon:    10.40744,
+		},
+		{
+			name:         "Yandex Maps centre is longitude first",
+			url:          "https://yandex.ru/maps/213/moscow/?ll=37.6173,55.7558&z=12",
+			expectSource: "Yandex Maps",
+			expectLat:    55.7558,
+			expectLon:    37.6173,
+			expectZoom:   12,
+		},
+		{
+			name:         "Yandex Maps placemark preferred over centre",
+			url:          "https://yandex.com/maps/?ll=37.6,55.7&pt=37.6205,55.7539,pm2rdm~30.3,59.9&z=16",
+			expectSource: "Yandex Maps",
+			expectLat:    55.7539,
+			expectLon:    37.6205,
+			expectZoom:   16,
+		},
+		{
+			name:         "Yandex Maps what's here",
+			url:          "https://yandex.com.tr/maps/?whatshere%5Bpoint%5D=28.9784,41.0082&whatshere%5Bzoom%5D=17",
+			expectSource: "Yandex Maps",
+			expectLat:    41.0082,
+			expectLon:    28.9784,
+			expectZoom:   17,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := gmaps.SourceOf(tc.url)
+			require.NotNil(t, source)
+			assert.Equal(t, tc.expectSource, source.Name())
+
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+			assert.Equal(t, tc.expectZoom, coords.Zoom)
+		})
+	}
+}
+
+func TestShortLinkFromOtherSourceIsParsedBySourceOfRedirect(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	mockClient := &mockRedirectHTTPClient{redirectMap: map[string]string{
+		"https://yandex.ru/maps/-/CDqZ6Oyj": "https://yandex.ru/maps/?ll=30.3141,59.9386&z=15",
+	}}
+	extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+	coords, err := extractor.ExtractCoordinates(context.Background(), "https://yandex.ru/maps/-/CDqZ6Oyj")
+	require.NoError(t, err)
+	assert.InDelta(t, 59.9386, coords.Latitude, 0.0001, "Yandex redirects are longitude first")
+	assert.InDelta(t, 30.3141, coords.Longitude, 0.0001)
+}
+
+func TestExtractMapURLs(t *testing.T) {
+	text := "Meet at https://maps.apple.com/?ll=50.894967,4.341626 or https://www.google.com/maps/@51.558,2.218,15z, " +
+		"parking https://www.waze.com/ul?ll=45.69,-120.81 but not https://www.bing.com/search?q=maps or https://example.com/?ll=1,2"
+
+	assert.ElementsMatch(t, []string{
+		"https://www.google.com/maps/@51.558,2.218,15z,",
+		"https://maps.apple.com/?ll=50.894967,4.341626",
+		"https://www.waze.com/ul?ll=45.69,-120.81",
+	}, gmaps.ExtractMapURLs(text))
+
+	assert.True(t, gmaps.IsMapURL("https://wego.here.com/?map=52.5308,13.3847,15,normal"))
+	assert.False(t, gmaps.IsMapURL("https://www.bing.com/search?q=maps"))
+	assert.Nil(t, gmaps.SourceOf("https://example.com/?ll=1,2"))
+}
+
+func TestDatumDependsOnSource(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		expectDatum gmaps.Datum
+	}{
+		{name: "Google Maps in China", url: "https://www.google.com/maps/@39.9087,116.3975,15z", expectDatum: gmaps.GCJ02},
+		{name: "Apple Maps in China", url: "https://maps.apple.com/?ll=39.9087,116.3975", expectDatum: gmaps.GCJ02},
+		{name: "Yandex Maps in China", url: "https://yandex.com/maps/?ll=116.3975,39.9087&z=15", expectDatum: gmaps.WGS84},
+		{name: "Waze in China", url: "https://www.waze.com/ul?ll=39.9087,116.3975", expectDatum: gmaps.WGS84},
+		{name: "Bing Maps in China", url: "https://www.bing.com/maps?cp=39.9087~116.3975", expectDatum: gmaps.WGS84},
+		{name: "Google Maps outside China", url: "https://www.google.com/maps/@51.5074,-0.1278,15z", expectDatum: gmaps.WGS84},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.url)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDatum, coords.Datum)
+		})
+	}
+
+	t.Run("Yandex short link in China", func(t *testing.T) {
+		logger := zaptest.NewLogger(t).Sugar()
+		mockClient := &mockRedirectHTTPClient{redirectMap: map[string]string{
+			"https://yandex.com/maps/-/CCUkR2": "https://yandex.com/maps/?ll=116.3975,39.9087&z=15",
+		}}
+		extractor := gmaps.NewExtractor(mockClient, 5, logger)
+
+		coords, err := extractor.ExtractCoordinates(context.Background(), "https://yandex.com/maps/-/CCUkR2")
+		require.NoError(t, err)
+		assert.Equal(t, gmaps.WGS84, coords.Datum)
+	})
+}
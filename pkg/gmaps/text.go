@@ -0,0 +1,280 @@
+package gmaps
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CoordinatesSourceName is the name of the source for coordinates written out in text rather than linked to
+const CoordinatesSourceName = "Coordinates"
+
+// Names of the ways coordinates are written out, used to label metrics
+const (
+	patternGeoURI  = "geo_uri"
+	patternDMS     = "dms"
+	patternDecimal = "decimal"
+)
+
+// dmsAngle matches degrees with optional minutes and seconds, like 51°30′26″, 51° 30.433' or 51.5074°
+const dmsAngle = `(\d{1,3}(?:\.\d+)?)[°º](?:\s*(\d{1,2}(?:\.\d+)?)['′’](?:\s*(\d{1,2}(?:\.\d+)?)(?:["″”]|''))?)?`
+
+// Coordinates written out in text
+var (
+	// geo: URIs (RFC 5870), like geo:51.5074,-0.1278;u=35?z=15, including Android's geo:0,0?q=51.5074,-0.1278(Label)
+	geoURIRegex = regexp.MustCompile(`(?i:geo):[-+]?\d+(?:\.\d+)?,[-+]?\d+(?:\.\d+)?(?:,[-+]?\d+(?:\.\d+)?)?(?:;[\w.:=-]+)*(?:\?[^\s<>"]*[^\s<>".,!?])?`)
+
+	// Degrees, minutes and seconds with the hemisphere after them, like 51°30′26″N 0°7′39″W
+	dmsRegex = regexp.MustCompile(dmsAngle + `\s*([NS])[\s,;/]*` + dmsAngle + `\s*([EW])`)
+
+	// Degrees and minutes with the hemisphere before them, like N 51° 30.433' W 000° 07.650'
+	dmsPrefixRegex = regexp.MustCompile(`([NS])\s*` + dmsAngle + `[\s,;/]*([EW])\s*` + dmsAngle)
+
+	// Decimal latitude and longitude separated by a comma, like 51.5074, -0.1278. Both need at
+	// least three decimal places, which rules out times like 12.30 and most version numbers
+	decimalCoordRegex = regexp.MustCompile(`([-+]?\d{1,2}\.\d{3,})\s*,\s*([-+]?\d{1,3}\.\d{3,})`)
+
+	// Links of any kind, whose coordinates are left to their sources
+	anyURLRegex = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^\s<>"]*`)
+)
+
+// textFormat is a way of writing out coordinates
+type textFormat struct {
+	pattern string
+	regex   *regexp.Regexp
+	parse   func(match []string) (*Coordinates, error)
+}
+
+// textFormats are the ways coordinates are written out, in the order they're looked for. Earlier
+// formats take precedence, so the coordinates in a geo: URI aren't found again as a decimal pair
+var textFormats = []textFormat{
+	{patternGeoURI, geoURIRegex, parseGeoURI},
+	{patternDMS, dmsRegex, func(m []string) (*Coordinates, error) {
+		return dmsCoordinates(m[1:4], m[4], m[5:8], m[8])
+	}},
+	{patternDMS, dmsPrefixRegex, func(m []string) (*Coordinates, error) {
+		return dmsCoordinates(m[2:5], m[1], m[6:9], m[5])
+	}},
+	{patternPlusCode, fullPlusCodeRegex, func(m []string) (*Coordinates, error) {
+		return DecodePlusCode(m[0])
+	}},
+	{patternDecimal, decimalCoordRegex, parseDecimalMatch},
+}
+
+// textCoordinates are coordinates found at text[start:end]. Coordinates is nil for short plus codes,
+// which need their locality looking up
+type textCoordinates struct {
+	start, end int
+	coords     *Coordinates
+	pattern    string
+}
+
+// findTextCoordinates finds the valid coordinates written out in text, in the order they appear.
+// Matches that are part of a link, a longer number or a word are skipped
+func findTextCoordinates(text string) []textCoordinates {
+	// Spans of the text already accounted for, starting with links
+	taken := anyURLRegex.FindAllStringIndex(text, -1)
+	overlapsTaken := func(start, end int) bool {
+		return slices.ContainsFunc(taken, func(span []int) bool { return start < span[1] && span[0] < end })
+	}
+
+	found := make([]textCoordinates, 0)
+	for _, format := range textFormats {
+		for _, loc := range format.regex.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if overlapsTaken(start, end) || !isolated(text, start, end) {
+				continue
+			}
+
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = text[loc[2*i]:loc[2*i+1]]
+				}
+			}
+
+			coords, err := format.parse(match)
+			if err != nil {
+				// A geo: URI that can't be used is still a URI, not coordinates for later formats
+				if format.pattern == patternGeoURI {
+					taken = append(taken, []int{start, end})
+				}
+				continue
+			}
+
+			taken = append(taken, []int{start, end})
+			found = append(found, textCoordinates{start: start, end: end, coords: coords, pattern: format.pattern})
+		}
+	}
+
+	for _, loc := range shortPlusCodeRegex.FindAllStringIndex(text, -1) {
+		if !overlapsTaken(loc[0], loc[1]) && isolated(text, loc[0], loc[1]) {
+			found = append(found, textCoordinates{start: loc[0], end: loc[1], pattern: patternPlusCode})
+		}
+	}
+
+	slices.SortFunc(found, func(a, b textCoordinates) int { return a.start - b.start })
+	return found
+}
+
+// isolated reports whether text[start:end] stands on its own rather than being part of a longer
+// number or word, like the 1.2345, 6.7890 in version 1.2345, 6.7890.1. A full stop after it is fine
+func isolated(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); before == '.' || isWordRune(before) {
+		return false
+	}
+
+	after, size := utf8.DecodeRuneInString(text[end:])
+	if after == '.' {
+		after, _ = utf8.DecodeRuneInString(text[end+size:])
+		return !unicode.IsDigit(after)
+	}
+	return !isWordRune(after)
+}
+
+// isWordRune reports whether r is a letter, digit or underscore
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// ExtractTextCoordinates finds coordinates written out in the given text: geo: URIs, plus codes,
+// decimal latitude and longitude pairs, and degrees, minutes and seconds with hemisphere letters.
+// Short plus codes are only found with their locality. Coordinates in links are left to the links' sources
+func ExtractTextCoordinates(text string) []string {
+	found := findTextCoordinates(text)
+
+	coords := make([]string, 0, len(found))
+	for _, f := range found {
+		coords = append(coords, text[f.start:f.end])
+	}
+	return deduplicate(coords)
+}
+
+// parseTextCoordinates parses coordinates written out in text, which must be the whole of text
+func parseTextCoordinates(text string) (*Coordinates, string, error) {
+	found := findTextCoordinates(text)
+	if len(found) != 1 || found[0].start != 0 || found[0].end != len(text) {
+		return nil, patternNone, fmt.Errorf("no coordinates found in %q", text)
+	}
+	if found[0].coords == nil {
+		return nil, found[0].pattern, fmt.Errorf("short plus code %q needs its locality looking up", text)
+	}
+	return found[0].coords, found[0].pattern, nil
+}
+
+// textCoordinatesSource is the source for coordinates written out in text rather than linked to
+type textCoordinatesSource struct{}
+
+func (textCoordinatesSource) Name() string { return CoordinatesSourceName }
+
+func (textCoordinatesSource) FindURLs(text string) []string { return ExtractTextCoordinates(text) }
+
+func (textCoordinatesSource) ParseURL(text string) (*Coordinates, string, error) {
+	return parseTextCoordinates(text)
+}
+
+// Datum is always WGS-84, as coordinates typed into a post come from GPS rather than a map
+func (textCoordinatesSource) Datum(lat, lon float64) Datum { return WGS84 }
+
+// parseGeoURI parses a geo: URI, taking the zoom from its z parameter. Android shares places
+// as geo:0,0?q=lat,lon(Label), so q is used instead when the coordinates are 0,0
+func parseGeoURI(match []string) (*Coordinates, error) {
+	uri := match[0][len("geo:"):]
+	uri, rawQuery, _ := strings.Cut(uri, "?")
+	point, params, _ := strings.Cut(uri, ";")
+
+	for _, param := range strings.Split(params, ";") {
+		if key, value, _ := strings.Cut(param, "="); strings.EqualFold(key, "crs") && !strings.EqualFold(value, "wgs84") {
+			return nil, fmt.Errorf("unsupported coordinate reference system %q", value)
+		}
+	}
+
+	coords, err := parseCoordPair(point, ",", false)
+	if err != nil {
+		return nil, err
+	}
+
+	query, _ := url.ParseQuery(rawQuery)
+	if q := query.Get("q"); q != "" && coords.Latitude == 0 && coords.Longitude == 0 {
+		q, _, _ = strings.Cut(q, "(")
+		if coords, err = parseCoordPair(q, ",", false); err != nil {
+			return nil, fmt.Errorf("geo URI searches for %q rather than coordinates", q)
+		}
+	}
+
+	coords.Zoom = parseZoom(query.Get("z"))
+	return coords, nil
+}
+
+// parseDecimalMatch parses a decimal latitude and longitude pair. Pairs which are both unsigned with
+// exactly three decimal places, like 10.000, 20.000, are more likely numbers with thousands separators
+func parseDecimalMatch(match []string) (*Coordinates, error) {
+	lat, lon := match[1], match[2]
+	if isThousands(lat) && isThousands(lon) {
+		return nil, fmt.Errorf("%s, %s looks like numbers with thousands separators", lat, lon)
+	}
+	return parseCoordMatch(lat, lon)
+}
+
+// isThousands reports whether number is unsigned with exactly three digits after its point
+func isThousands(number string) bool {
+	whole, fraction, _ := strings.Cut(number, ".")
+	return !strings.ContainsAny(whole, "+-") && len(fraction) == 3
+}
+
+// dmsCoordinates converts latitude and longitude angles, each as degrees, minutes and seconds, and
+// their hemispheres to coordinates
+func dmsCoordinates(latAngle []string, latHemisphere string, lonAngle []string, lonHemisphere string) (*Coordinates, error) {
+	lat, err := dmsToDegrees(latAngle[0], latAngle[1], latAngle[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if latHemisphere == "S" {
+		lat = -lat
+	}
+
+	lon, err := dmsToDegrees(lonAngle[0], lonAngle[1], lonAngle[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude: %w", err)
+	}
+	if lonHemisphere == "W" {
+		lon = -lon
+	}
+
+	return newCoordinates(lat, lon)
+}
+
+// dmsToDegrees converts an angle in degrees and optional minutes and seconds to degrees. Only the
+// last part given may have a fractional part, and minutes and seconds must be less than 60
+func dmsToDegrees(degreesStr, minutesStr, secondsStr string) (float64, error) {
+	parts := []string{degreesStr, minutesStr, secondsStr}
+	divisors := []float64{1, 60, 3600}
+
+	var degrees float64
+	for i, part := range parts {
+		if part == "" {
+			break
+		}
+		if i > 0 && strings.Contains(parts[i-1], ".") {
+			return 0, fmt.Errorf("fractional part before the last in %s°%s′%s″", degreesStr, minutesStr, secondsStr)
+		}
+
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 && value >= 60 {
+			return 0, fmt.Errorf("%s out of range in %s°%s′%s″", part, degreesStr, minutesStr, secondsStr)
+		}
+		degrees += value / divisors[i]
+	}
+
+	// Rounded to about 10cm, so thirds of a second don't show as endless decimals in links
+	return math.Round(degrees*1e6) / 1e6, nil
+}
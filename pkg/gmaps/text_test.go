@@ -0,0 +1,175 @@
+package gmaps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExtractTextCoordinates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "Decimal pair",
+			text:     "Meet at 51.5074, -0.1278 tomorrow",
+			expected: []string{"51.5074, -0.1278"},
+		},
+		{
+			name:     "Decimal pair ending a sentence",
+			text:     "It's at 40.689247,-74.044502.",
+			expected: []string{"40.689247,-74.044502"},
+		},
+		{
+			name:     "Degrees, minutes and seconds",
+			text:     "The summit is at 45°49′58″N 6°51′54″E, see you there",
+			expected: []string{"45°49′58″N 6°51′54″E"},
+		},
+		{
+			name:     "Degrees and minutes with hemispheres first",
+			text:     "Cache at N 51° 30.433' W 000° 07.650'",
+			expected: []string{"N 51° 30.433' W 000° 07.650'"},
+		},
+		{
+			name:     "geo URI",
+			text:     "geo:51.5074,-0.1278?z=15 is where it is",
+			expected: []string{"geo:51.5074,-0.1278?z=15"},
+		},
+		{
+			name:     "Several in order",
+			text:     "From 51°30′26″N 0°7′39″W to 48.8584, 2.2945",
+			expected: []string{"51°30′26″N 0°7′39″W", "48.8584, 2.2945"},
+		},
+		{
+			name:     "Times",
+			text:     "Doors at 19.30, 20.45 start, or 19:30, 20:45",
+			expected: []string{},
+		},
+		{
+			name:     "Version numbers",
+			text:     "Upgrade from 1.2.345, 1.3.000 or v2.1234, 3.4567",
+			expected: []string{},
+		},
+		{
+			name:     "Thousands separators",
+			text:     "Between 10.000, 20.000 people came",
+			expected: []string{},
+		},
+		{
+			name:     "Out of range",
+			text:     "Readings 95.1234, 10.1234 and 91°N 0°E",
+			expected: []string{},
+		},
+		{
+			name:     "Inside links",
+			text:     "https://example.com/?ll=51.5074,-0.1278 and https://www.google.com/maps/@51.558,2.218,15z",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, gmaps.ExtractTextCoordinates(tc.text))
+		})
+	}
+}
+
+func TestExtractCoordinatesFromText(t *testing.T) {
+	testCases := []struct {
+		name        string
+		text        string
+		expectLat   float64
+		expectLon   float64
+		expectZoom  int
+		expectDatum gmaps.Datum
+	}{
+		{
+			name:      "Decimal pair",
+			text:      "51.5074, -0.1278",
+			expectLat: 51.5074,
+			expectLon: -0.1278,
+		},
+		{
+			name:      "Degrees, minutes and seconds in the southern and western hemispheres",
+			text:      `22°54'30"S 43°11'47"W`,
+			expectLat: -22.908333,
+			expectLon: -43.196389,
+		},
+		{
+			name:      "Decimal degrees with hemispheres",
+			text:      "35.6586° N, 139.7454° E",
+			expectLat: 35.6586,
+			expectLon: 139.7454,
+		},
+		{
+			name:      "Degrees and decimal minutes with hemispheres first",
+			text:      "N 51° 30.433' W 000° 07.650'",
+			expectLat: 51.507217,
+			expectLon: -0.1275,
+		},
+		{
+			name:       "geo URI with uncertainty and zoom",
+			text:       "geo:48.8584,2.2945;u=35?z=16",
+			expectLat:  48.8584,
+			expectLon:  2.2945,
+			expectZoom: 16,
+		},
+		{
+			name:      "Android geo URI",
+			text:      "geo:0,0?q=37.7749,-122.4194(Golden+Gate)",
+			expectLat: 37.7749,
+			expectLon: -122.4194,
+		},
+		{
+			name:        "Decimal pair in mainland China is WGS-84",
+			text:        "31.2304, 121.4737",
+			expectLat:   31.2304,
+			expectLon:   121.4737,
+			expectDatum: gmaps.WGS84,
+		},
+		{
+			name:        "Degrees, minutes and seconds in mainland China are WGS-84",
+			text:        "31°13′49″N 121°28′25″E",
+			expectLat:   31.230278,
+			expectLon:   121.473611,
+			expectDatum: gmaps.WGS84,
+		},
+		{
+			name:        "geo URI in mainland China is WGS-84",
+			text:        "geo:39.9087,116.3975",
+			expectLat:   39.9087,
+			expectLon:   116.3975,
+			expectDatum: gmaps.WGS84,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := gmaps.SourceOf(tc.text)
+			require.NotNil(t, source)
+			assert.Equal(t, gmaps.CoordinatesSourceName, source.Name())
+
+			logger := zaptest.NewLogger(t).Sugar()
+			extractor := gmaps.NewExtractor(&mockHTTPClient{}, 5, logger)
+
+			coords, err := extractor.ExtractCoordinates(context.Background(), tc.text)
+			require.NoError(t, err)
+			assert.InDelta(t, tc.expectLat, coords.Latitude, 0.0001, "Latitude should match")
+			assert.InDelta(t, tc.expectLon, coords.Longitude, 0.0001, "Longitude should match")
+			assert.Equal(t, tc.expectZoom, coords.Zoom)
+			assert.Equal(t, tc.expectDatum, coords.Datum)
+		})
+	}
+}
+
+func TestGeoURIWithoutCoordinatesIsNotFound(t *testing.T) {
+	assert.Empty(t, gmaps.ExtractTextCoordinates("geo:0,0?q=Eiffel+Tower"))
+	assert.Empty(t, gmaps.ExtractTextCoordinates("geo:51.5074,-0.1278;crs=EPSG:27700"))
+	assert.False(t, gmaps.IsMapURL("51.5074, -0.1278 and more"))
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of the bot's health, served as JSON by /healthz and /readyz
+type Status struct {
+	// Healthy is false once the last successful poll is older than the maximum age
+	Healthy bool `json:"healthy"`
+
+	// Ready is true once credentials are verified and notifications have been fetched, while healthy
+	Ready bool `json:"ready"`
+
+	// CredentialsVerified is true once the bot account has been verified with the server
+	CredentialsVerified bool `json:"credentials_verified"`
+
+	// LastSuccess is when notifications were last processed without error, unset if they never were
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+
+	// SinceLastSuccess is how long ago LastSuccess was, or how long since startup if there hasn't been one
+	SinceLastSuccess string `json:"since_last_success"`
+
+	// MaxAge is how old LastSuccess may get before the bot is unhealthy
+	MaxAge string `json:"max_age"`
+
+	// PollInterval is the current polling interval, including any backoff
+	PollInterval string `json:"poll_interval"`
+
+	// ConsecutiveErrors is how many polls in a row have failed
+	ConsecutiveErrors int `json:"consecutive_errors"`
+}
+
+// Tracker records the state of the bot's poll loop for health checks. It is safe for concurrent use
+type Tracker struct {
+	mu                sync.Mutex
+	maxAge            time.Duration
+	started           time.Time
+	verified          bool
+	lastSuccess       time.Time
+	pollInterval      time.Duration
+	consecutiveErrors int
+}
+
+// NewTracker creates a tracker which reports the bot as unhealthy once notifications haven't been
+// processed successfully for maxAge. Startup counts as a success, giving the bot maxAge to get going
+func NewTracker(maxAge time.Duration) *Tracker {
+	return &Tracker{
+		maxAge:  maxAge,
+		started: time.Now(),
+	}
+}
+
+// CredentialsVerified records that the bot account has been verified with the server
+func (t *Tracker) CredentialsVerified() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.verified = true
+}
+
+// Succeeded records that notifications were just processed without error
+func (t *Tracker) Succeeded() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSuccess = time.Now()
+}
+
+// SetBackoff records the current polling interval and how many polls in a row have failed
+func (t *Tracker) SetBackoff(interval time.Duration, consecutiveErrors int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pollInterval = interval
+	t.consecutiveErrors = consecutiveErrors
+}
+
+// Status returns a snapshot of the current health
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := Status{
+		CredentialsVerified: t.verified,
+		MaxAge:              t.maxAge.String(),
+		PollInterval:        t.pollInterval.String(),
+		ConsecutiveErrors:   t.consecutiveErrors,
+	}
+
+	since := t.started
+	if !t.lastSuccess.IsZero() {
+		lastSuccess := t.lastSuccess
+		status.LastSuccess = &lastSuccess
+		since = lastSuccess
+	}
+
+	age := time.Since(since)
+	status.SinceLastSuccess = age.Round(time.Millisecond).String()
+	status.Healthy = age <= t.maxAge
+	status.Ready = status.Healthy && t.verified && status.LastSuccess != nil
+
+	return status
+}
+
+// LivenessHandler serves /healthz, responding 503 once the last successful poll is too old
+func (t *Tracker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := t.Status()
+		writeStatus(w, status, status.Healthy)
+	})
+}
+
+// ReadinessHandler serves /readyz, responding 503 until the bot is verified, has fetched
+// notifications and is healthy
+func (t *Tracker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := t.Status()
+		writeStatus(w, status, status.Ready)
+	})
+}
+
+// writeStatus writes status as JSON, with 200 if ok and 503 otherwise
+func writeStatus(w http.ResponseWriter, status Status, ok bool) {
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
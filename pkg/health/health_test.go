@@ -0,0 +1,73 @@
+package health_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, handler http.Handler) (int, health.Status) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var status health.Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return rec.Code, status
+}
+
+func TestReadyOnceVerifiedAndPolled(t *testing.T) {
+	tracker := health.NewTracker(time.Minute)
+
+	code, status := get(t, tracker.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, status.CredentialsVerified)
+
+	// Healthy during the startup grace period even though nothing has succeeded yet
+	code, _ = get(t, tracker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	tracker.CredentialsVerified()
+	code, _ = get(t, tracker.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	tracker.Succeeded()
+	tracker.SetBackoff(2*time.Minute, 1)
+	code, status = get(t, tracker.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, status.Ready)
+	assert.True(t, status.CredentialsVerified)
+	assert.NotNil(t, status.LastSuccess)
+	assert.Equal(t, "2m0s", status.PollInterval)
+	assert.Equal(t, 1, status.ConsecutiveErrors)
+}
+
+func TestUnhealthyWhenLastSuccessTooOld(t *testing.T) {
+	tracker := health.NewTracker(20 * time.Millisecond)
+	tracker.CredentialsVerified()
+	tracker.Succeeded()
+
+	code, _ := get(t, tracker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	time.Sleep(40 * time.Millisecond)
+
+	code, status := get(t, tracker.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, status.Healthy)
+
+	code, status = get(t, tracker.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, status.Ready)
+
+	tracker.Succeeded()
+	code, _ = get(t, tracker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,111 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// RequiredScopes are the OAuth scopes the bot needs, and all it asks for when registering
+var RequiredScopes = []string{
+	"read:notifications",
+	"read:statuses",
+	"profile",
+	"write:notifications",
+	"write:statuses",
+}
+
+// OOBRedirectURI makes the server show the authorization code to the user rather than redirecting
+const OOBRedirectURI = "urn:ietf:wg:oauth:2.0:oob"
+
+// RegisterApp registers the bot as an application on server with RequiredScopes
+func RegisterApp(ctx context.Context, server, clientName, website string) (*mastodon.Application, error) {
+	return mastodon.RegisterApp(ctx, &mastodon.AppConfig{
+		Server:       server,
+		ClientName:   clientName,
+		RedirectURIs: OOBRedirectURI,
+		Scopes:       strings.Join(RequiredScopes, " "),
+		Website:      website,
+	})
+}
+
+// tokenInfo is the response from /oauth/token/info. Depending on the server version the
+// scopes are either a list or a space-separated string
+type tokenInfo struct {
+	Scope json.RawMessage `json:"scope"`
+}
+
+// TokenScopes returns the scopes granted to the client's access token
+func TokenScopes(ctx context.Context, client *mastodon.Client) ([]string, error) {
+	u, err := url.Parse(client.Config.Server)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/oauth/token/info")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+client.Config.AccessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token info request failed: %s", resp.Status)
+	}
+
+	var info tokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid token info: %w", err)
+	}
+
+	var scopes []string
+	if err := json.Unmarshal(info.Scope, &scopes); err == nil {
+		return scopes, nil
+	}
+
+	var scope string
+	if err := json.Unmarshal(info.Scope, &scope); err != nil {
+		return nil, fmt.Errorf("invalid token info scope %s", info.Scope)
+	}
+	return strings.Fields(scope), nil
+}
+
+// MissingScopes returns the RequiredScopes not covered by granted, allowing for the broader
+// read and write scopes covering their read:* and write:* scopes
+func MissingScopes(granted []string) []string {
+	var missing []string
+	for _, required := range RequiredScopes {
+		if !scopeGranted(required, granted) {
+			missing = append(missing, required)
+		}
+	}
+	return missing
+}
+
+// scopeGranted reports whether scope is covered by granted
+func scopeGranted(scope string, granted []string) bool {
+	if slices.Contains(granted, scope) {
+		return true
+	}
+
+	// profile only gives access to the current account, which read and read:accounts also do
+	if scope == "profile" {
+		return slices.Contains(granted, "read") || slices.Contains(granted, "read:accounts")
+	}
+
+	parent, _, ok := strings.Cut(scope, ":")
+	return ok && slices.Contains(granted, parent)
+}
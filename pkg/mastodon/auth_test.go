@@ -0,0 +1,78 @@
+package mastodon_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	customMastodon "github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/mastodon"
+	"github.com/mattn/go-mastodon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingScopes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		granted  []string
+		expected []string
+	}{
+		{
+			name:    "exact scopes",
+			granted: []string{"read:notifications", "read:statuses", "profile", "write:notifications", "write:statuses"},
+		},
+		{
+			name:    "broad scopes",
+			granted: []string{"read", "write"},
+		},
+		{
+			name:    "read:accounts covers profile",
+			granted: []string{"read:accounts", "read:notifications", "read:statuses", "write"},
+		},
+		{
+			name:     "read only",
+			granted:  []string{"read"},
+			expected: []string{"write:notifications", "write:statuses"},
+		},
+		{
+			name:     "nothing",
+			expected: customMastodon.RequiredScopes,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, customMastodon.MissingScopes(tc.granted))
+		})
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{name: "list", body: `{"resource_owner_id":1,"scope":["read","write:statuses"],"expires_in":null}`},
+		{name: "string", body: `{"resource_owner_id":1,"scope":"read write:statuses","expires_in":null}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/oauth/token/info" || r.Header.Get("Authorization") != "Bearer token" {
+					http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := mastodon.NewClient(&mastodon.Config{Server: server.URL, AccessToken: "token"})
+			scopes, err := customMastodon.TokenScopes(context.Background(), client)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"read", "write:statuses"}, scopes)
+		})
+	}
+}
@@ -9,12 +9,12 @@ import (
 
 // ReplyChecker checks if the bot has already replied to a status
 type ReplyChecker struct {
-	client *mastodon.Client
+	client Client
 	logger *zap.SugaredLogger
 }
 
 // NewReplyChecker creates a new reply checker
-func NewReplyChecker(client *mastodon.Client, logger *zap.SugaredLogger) *ReplyChecker {
+func NewReplyChecker(client Client, logger *zap.SugaredLogger) *ReplyChecker {
 	return &ReplyChecker{
 		client: client,
 		logger: logger,
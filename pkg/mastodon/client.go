@@ -0,0 +1,33 @@
+package mastodon
+
+import (
+	"context"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Client is the part of the Mastodon API the bot uses. *mastodon.Client implements it
+type Client interface {
+	// GetAccountCurrentUser returns the authenticated account
+	GetAccountCurrentUser(ctx context.Context) (*mastodon.Account, error)
+
+	// GetNotifications returns a page of notifications, updating pg to point at the next page
+	GetNotifications(ctx context.Context, pg *mastodon.Pagination) ([]*mastodon.Notification, error)
+
+	// DismissNotification removes a notification
+	DismissNotification(ctx context.Context, id mastodon.ID) error
+
+	// GetStatus returns a status
+	GetStatus(ctx context.Context, id mastodon.ID) (*mastodon.Status, error)
+
+	// GetStatusContext returns the ancestors and descendants of a status
+	GetStatusContext(ctx context.Context, id mastodon.ID) (*mastodon.Context, error)
+
+	// PostStatus posts a new status
+	PostStatus(ctx context.Context, toot *mastodon.Toot) (*mastodon.Status, error)
+
+	// StreamingUser subscribes to the authenticated user's event stream
+	StreamingUser(ctx context.Context) (chan mastodon.Event, error)
+}
+
+var _ Client = (*mastodon.Client)(nil)
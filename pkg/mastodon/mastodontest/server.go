@@ -0,0 +1,371 @@
+// Package mastodontest provides an in-memory fake Mastodon server for end-to-end tests of the bot
+package mastodontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// AccessToken is the only access token the server accepts
+const AccessToken = "mastodontest-token"
+
+// defaultNotificationsLimit is how many notifications are returned per page when no limit is given
+const defaultNotificationsLimit = 40
+
+// Server is an httptest server implementing the parts of the Mastodon API the bot uses: the
+// current account, notifications, statuses and their context, dismissing notifications and posting
+type Server struct {
+	*httptest.Server
+
+	// Account is the authenticated account, which posted statuses belong to
+	Account *mastodon.Account
+
+	mu            sync.Mutex
+	nextID        int
+	statuses      map[mastodon.ID]*mastodon.Status
+	notifications []*mastodon.Notification
+	dismissed     []mastodon.ID
+	failures      map[string][]int
+	held          map[string]chan struct{}
+	requests      map[string]int
+}
+
+// NewServer starts a fake server which is closed when the test finishes
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Account:  &mastodon.Account{ID: "1", Username: "gMapsToOSM", Acct: "gMapsToOSM"},
+		nextID:   100,
+		statuses: map[mastodon.ID]*mastodon.Status{},
+		failures: map[string][]int{},
+		held:     map[string]chan struct{}{},
+		requests: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	s.handle(mux, "GET /api/v1/accounts/verify_credentials", s.verifyCredentials)
+	s.handle(mux, "GET /api/v1/notifications", s.getNotifications)
+	s.handle(mux, "POST /api/v1/notifications/{id}/dismiss", s.dismissNotification)
+	s.handle(mux, "GET /api/v1/statuses/{id}", s.getStatus)
+	s.handle(mux, "GET /api/v1/statuses/{id}/context", s.getStatusContext)
+	s.handle(mux, "POST /api/v1/statuses", s.postStatus)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a client configuration for the server
+func (s *Server) Config() *mastodon.Config {
+	return &mastodon.Config{Server: s.URL, AccessToken: AccessToken}
+}
+
+// AddStatus adds a public status by account, optionally in reply to another status
+func (s *Server) AddStatus(account *mastodon.Account, content string, inReplyToID mastodon.ID) *mastodon.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addStatus(account, content, inReplyToID, "public")
+}
+
+// Mention adds a status by account mentioning the bot and notifies the bot about it
+func (s *Server) Mention(account *mastodon.Account, content string, inReplyToID mastodon.ID) *mastodon.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.addStatus(account, content, inReplyToID, "public")
+	return s.notify(&mastodon.Notification{Type: "mention", Account: *account, Status: status})
+}
+
+// Notify adds a notification, such as a favourite, for the bot
+func (s *Server) Notify(notif *mastodon.Notification) *mastodon.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notify(notif)
+}
+
+// Notifications returns the notifications which haven't been dismissed, oldest first
+func (s *Server) Notifications() []*mastodon.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.notifications)
+}
+
+// Dismissed returns the IDs of the dismissed notifications, in the order they were dismissed
+func (s *Server) Dismissed() []mastodon.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.dismissed)
+}
+
+// Replies returns the statuses posted in reply to statusID, oldest first
+func (s *Server) Replies(statusID mastodon.ID) []*mastodon.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replies []*mastodon.Status
+	for _, status := range s.sortedStatuses() {
+		if status.InReplyToID == string(statusID) {
+			replies = append(replies, status)
+		}
+	}
+	return replies
+}
+
+// Fail makes the next requests to the endpoint, given as its method and path pattern
+// (e.g. "POST /api/v1/statuses"), fail with the given status codes in turn
+func (s *Server) Fail(endpoint string, codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], codes...)
+}
+
+// Hold makes requests to the endpoint, given as for Fail, hang until the client gives up or the test finishes
+func (s *Server) Hold(t testing.TB, endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := make(chan struct{})
+	s.held[endpoint] = held
+	t.Cleanup(func() { close(held) })
+}
+
+// Requests returns how many requests were made to the endpoint, given as for Fail
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// handle registers handler for endpoint, checking authorization, held requests and injected failures first
+func (s *Server) handle(mux *http.ServeMux, endpoint string, handler http.HandlerFunc) {
+	mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[endpoint]++
+		var failure int
+		if codes := s.failures[endpoint]; len(codes) > 0 {
+			failure, s.failures[endpoint] = codes[0], codes[1:]
+		}
+		held := s.held[endpoint]
+		s.mu.Unlock()
+
+		if held != nil {
+			select {
+			case <-held:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+			writeError(w, http.StatusUnauthorized, "The access token is invalid")
+			return
+		}
+		if failure != 0 {
+			writeError(w, failure, "injected failure")
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
+func (s *Server) verifyCredentials(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Account)
+}
+
+// getNotifications serves the notifications newest first, paging with max_id and limit
+func (s *Server) getNotifications(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := defaultNotificationsLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	maxID := r.URL.Query().Get("max_id")
+
+	page := []*mastodon.Notification{}
+	for _, notif := range slices.Backward(s.notifications) {
+		if len(page) == limit {
+			break
+		}
+		if maxID == "" || idLess(string(notif.ID), maxID) {
+			page = append(page, notif)
+		}
+	}
+
+	// Like Mastodon, link to the next page whenever this one isn't empty
+	if len(page) > 0 {
+		next := url.URL{Path: "/api/v1/notifications", RawQuery: url.Values{"max_id": {string(page[len(page)-1].ID)}}.Encode()}
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"next\"", s.URL, next.String()))
+	}
+
+	writeJSON(w, page)
+}
+
+func (s *Server) dismissNotification(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := mastodon.ID(r.PathValue("id"))
+	i := slices.IndexFunc(s.notifications, func(notif *mastodon.Notification) bool { return notif.ID == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Record not found")
+		return
+	}
+
+	s.notifications = slices.Delete(s.notifications, i, i+1)
+	s.dismissed = append(s.dismissed, id)
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[mastodon.ID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Record not found")
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (s *Server) getStatusContext(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[mastodon.ID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Record not found")
+		return
+	}
+
+	statusCtx := mastodon.Context{Ancestors: []*mastodon.Status{}, Descendants: []*mastodon.Status{}}
+	for parent := status.InReplyToID; parent != nil && parent != ""; {
+		ancestor, ok := s.statuses[mastodon.ID(fmt.Sprint(parent))]
+		if !ok {
+			break
+		}
+		statusCtx.Ancestors = append([]*mastodon.Status{ancestor}, statusCtx.Ancestors...)
+		parent = ancestor.InReplyToID
+	}
+
+	// Descendants are found breadth first, which is close enough to Mastodon's thread order
+	ids := []string{string(status.ID)}
+	for len(ids) > 0 {
+		var next []string
+		for _, candidate := range s.sortedStatuses() {
+			if slices.Contains(ids, fmt.Sprint(candidate.InReplyToID)) {
+				statusCtx.Descendants = append(statusCtx.Descendants, candidate)
+				next = append(next, string(candidate.ID))
+			}
+		}
+		ids = next
+	}
+
+	writeJSON(w, statusCtx)
+}
+
+func (s *Server) postStatus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.PostForm.Get("status") == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation failed: Text can't be blank")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inReplyToID := mastodon.ID(r.PostForm.Get("in_reply_to_id"))
+	if _, ok := s.statuses[inReplyToID]; inReplyToID != "" && !ok {
+		writeError(w, http.StatusNotFound, "Record not found")
+		return
+	}
+
+	visibility := r.PostForm.Get("visibility")
+	if visibility == "" {
+		visibility = "public"
+	}
+
+	writeJSON(w, s.addStatus(s.Account, r.PostForm.Get("status"), inReplyToID, visibility))
+}
+
+// addStatus stores a new status. s.mu must be held
+func (s *Server) addStatus(account *mastodon.Account, content string, inReplyToID mastodon.ID, visibility string) *mastodon.Status {
+	status := &mastodon.Status{
+		ID:         s.newID(),
+		Account:    *account,
+		Content:    content,
+		Visibility: visibility,
+		CreatedAt:  time.Now(),
+	}
+	if inReplyToID != "" {
+		status.InReplyToID = string(inReplyToID)
+	}
+
+	s.statuses[status.ID] = status
+	return status
+}
+
+// notify stores a new notification. s.mu must be held
+func (s *Server) notify(notif *mastodon.Notification) *mastodon.Notification {
+	notif.ID = s.newID()
+	if notif.CreatedAt.IsZero() {
+		notif.CreatedAt = time.Now()
+	}
+	s.notifications = append(s.notifications, notif)
+	return notif
+}
+
+// newID returns an ID greater than all previous ones. s.mu must be held
+func (s *Server) newID() mastodon.ID {
+	s.nextID++
+	return mastodon.ID(strconv.Itoa(s.nextID))
+}
+
+// sortedStatuses returns every status, oldest first. s.mu must be held
+func (s *Server) sortedStatuses() []*mastodon.Status {
+	statuses := make([]*mastodon.Status, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b *mastodon.Status) int {
+		if idLess(string(a.ID), string(b.ID)) {
+			return -1
+		}
+		return 1
+	})
+	return statuses
+}
+
+// idLess compares numeric IDs, as Mastodon's IDs sort by creation time
+func idLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,91 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+	"go.uber.org/zap"
+)
+
+// ErrStreamDropped is returned when the notification stream fails and the caller should fall back to polling
+var ErrStreamDropped = errors.New("notification stream dropped")
+
+// NotificationStream subscribes to the user notification stream
+type NotificationStream struct {
+	client Client
+	logger *zap.SugaredLogger
+}
+
+// NewNotificationStream creates a new notification stream
+func NewNotificationStream(client Client, logger *zap.SugaredLogger) *NotificationStream {
+	return &NotificationStream{
+		client: client,
+		logger: logger,
+	}
+}
+
+// Stream calls handle for every notification as it arrives. It blocks until ctx is
+// cancelled, returning ctx.Err(), or the stream drops, returning an error wrapping ErrStreamDropped
+func (ns *NotificationStream) Stream(ctx context.Context, handle func(context.Context, *mastodon.Notification)) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	events, err := ns.client.StreamingUser(streamCtx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("%w: %v", ErrStreamDropped, err)
+	}
+
+	// go-mastodon reconnects until its context is cancelled and blocks on sending
+	// events, so keep draining the channel until it is closed
+	defer func() {
+		cancel()
+		go func() {
+			for range events {
+			}
+		}()
+	}()
+
+	ns.logger.Info("Subscribed to notification stream")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return ErrStreamDropped
+			}
+
+			switch e := event.(type) {
+			case *mastodon.NotificationEvent:
+				ns.logger.Debugw("Received streamed notification", "notificationID", e.Notification.ID, "type", e.Notification.Type)
+				handle(ctx, e.Notification)
+			case *mastodon.ErrorEvent:
+				// A single event that can't be decoded doesn't mean the connection has failed
+				if isMalformedEvent(e.Err) {
+					ns.logger.Warnw("Ignoring malformed stream event", "error", e.Err)
+					continue
+				}
+				return fmt.Errorf("%w: %v", ErrStreamDropped, e.Err)
+			default:
+				ns.logger.Debugw("Ignoring stream event", "type", fmt.Sprintf("%T", event))
+			}
+		}
+	}
+}
+
+// isMalformedEvent reports whether a stream error is an event's data failing to decode, rather than
+// the connection failing
+func isMalformedEvent(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &timeErr)
+}
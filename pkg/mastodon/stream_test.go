@@ -0,0 +1,132 @@
+package mastodon_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	customMastodon "github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/mastodon"
+	"github.com/mattn/go-mastodon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// newFakeStreamingServer serves the given server-sent events on the first connection
+// to the user stream and fails every reconnection attempt
+func newFakeStreamingServer(t *testing.T, events ...string) *httptest.Server {
+	var connections atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/streaming/user", func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) > 1 {
+			http.Error(w, `{"error":"stream unavailable"}`, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for _, event := range events {
+			fmt.Fprint(w, event)
+		}
+		w.(http.Flusher).Flush()
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNotificationStreamDeliversNotificationsUntilDropped(t *testing.T) {
+	server := newFakeStreamingServer(t,
+		":thump\n\n",
+		"event: update\ndata: {\"id\":\"99\",\"content\":\"not a notification\"}\n\n",
+		"event: notification\ndata: {\"id\":\"1\",\"type\":\"mention\",\"status\":{\"id\":\"10\",\"content\":\"hello\"}}\n\n",
+		"event: notification\ndata: {\"id\":\"2\",\"type\":\"favourite\"}\n\n",
+	)
+
+	client := mastodon.NewClient(&mastodon.Config{Server: server.URL, AccessToken: "token"})
+	stream := customMastodon.NewNotificationStream(client, zaptest.NewLogger(t).Sugar())
+
+	var mu sync.Mutex
+	var received []*mastodon.Notification
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := stream.Stream(ctx, func(_ context.Context, notif *mastodon.Notification) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, notif)
+	})
+
+	require.ErrorIs(t, err, customMastodon.ErrStreamDropped)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	assert.Equal(t, mastodon.ID("1"), received[0].ID)
+	assert.Equal(t, "mention", received[0].Type)
+	require.NotNil(t, received[0].Status)
+	assert.Equal(t, mastodon.ID("10"), received[0].Status.ID)
+	assert.Equal(t, mastodon.ID("2"), received[1].ID)
+}
+
+func TestNotificationStreamSkipsMalformedEvents(t *testing.T) {
+	server := newFakeStreamingServer(t,
+		"event: notification\ndata: {not json}\n\n",
+		"event: notification\ndata: {\"id\":\"3\",\"type\":3}\n\n",
+		"event: notification\ndata: {\"id\":\"4\",\"type\":\"mention\",\"created_at\":\"yesterday\"}\n\n",
+		"event: notification\ndata: {\"id\":\"5\",\"type\":\"mention\",\"status\":{\"id\":\"50\",\"content\":\"hello\"}}\n\n",
+	)
+
+	client := mastodon.NewClient(&mastodon.Config{Server: server.URL, AccessToken: "token"})
+	stream := customMastodon.NewNotificationStream(client, zaptest.NewLogger(t).Sugar())
+
+	var received []mastodon.ID
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := stream.Stream(ctx, func(_ context.Context, notif *mastodon.Notification) {
+		received = append(received, notif.ID)
+	})
+
+	// The stream only drops once reconnecting fails
+	require.ErrorIs(t, err, customMastodon.ErrStreamDropped)
+	assert.Equal(t, []mastodon.ID{"5"}, received)
+}
+
+func TestNotificationStreamStopsOnCancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/streaming/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := mastodon.NewClient(&mastodon.Config{Server: server.URL, AccessToken: "token"})
+	stream := customMastodon.NewNotificationStream(client, zaptest.NewLogger(t).Sugar())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := stream.Stream(ctx, func(context.Context, *mastodon.Notification) {
+		t.Error("No notifications should be delivered")
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
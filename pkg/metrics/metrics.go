@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "gmaps2osm"
+
+// Registry holds the bot's metrics along with the standard Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// Mastodon loop
+var (
+	// NotificationsFetched counts notifications received by source, "poll" or "stream"
+	NotificationsFetched = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_fetched_total",
+		Help:      "Notifications received from the Mastodon API, by polling or from the stream.",
+	}, []string{"source"})
+
+	// MentionsProcessed counts handled mentions by result, "success" or "error"
+	MentionsProcessed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mentions_processed_total",
+		Help:      "Mentions processed, by result.",
+	}, []string{"result"})
+
+	// RepliesPosted counts replies posted to Mastodon
+	RepliesPosted = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replies_posted_total",
+		Help:      "Replies posted to Mastodon.",
+	})
+
+	// PollInterval is the current polling interval including any backoff
+	PollInterval = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "poll_interval_seconds",
+		Help:      "Current notification polling interval, including backoff.",
+	})
+
+	// PollConsecutiveErrors is how many polls in a row have failed
+	PollConsecutiveErrors = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "poll_consecutive_errors",
+		Help:      "Number of consecutive failed notification polls.",
+	})
+
+	// Streaming is 1 while mentions are being received from the streaming API
+	Streaming = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "streaming",
+		Help:      "Whether mentions are currently being received from the streaming API.",
+	})
+
+	// MastodonRequestDuration is the latency of Mastodon API requests
+	MastodonRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mastodon_request_duration_seconds",
+		Help:      "Latency of Mastodon API requests until response headers are received, by method, endpoint and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint", "code"})
+)
+
+// Conversion
+var (
+	// Conversions counts coordinate extractions by method ("direct" or "redirect"), the URL pattern the
+	// coordinates were found with ("none" if no pattern matched) and result ("success" or "failure")
+	Conversions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversions_total",
+		Help:      "Map link conversions, by method, URL pattern and result.",
+	}, []string{"method", "pattern", "result"})
+
+	// HTTPRequests counts requests made to resolve links, by method and status code ("error" if no response)
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests made through the rate-limited client to resolve links, by method and status code.",
+	}, []string{"method", "code"})
+
+	// HTTPRetries counts requests retried after being throttled, by the rate limit bucket of their destination
+	HTTPRetries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_retries_total",
+		Help:      "HTTP requests to resolve links retried after a 429 or 503 response, by destination.",
+	}, []string{"bucket"})
+
+	// ResolutionCacheLookups counts lookups of followed links in the resolution cache, by result
+	// ("hit", "negative_hit" for a cached failure, or "miss")
+	ResolutionCacheLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resolution_cache_lookups_total",
+		Help:      "Lookups of links to follow in the resolution cache, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// StatusCode returns the label for a response status code, or "error" if there was no response
+func StatusCode(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
+
+// MastodonTransport wraps next, recording the latency of every request in MastodonRequestDuration
+func MastodonTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return promhttp.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		MastodonRequestDuration.WithLabelValues(req.Method, Endpoint(req.URL.Path), StatusCode(resp, err)).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+// Endpoint replaces the IDs in a Mastodon API path with ":id", to keep the number of label values down
+func Endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpoint(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/api/v1/notifications", expected: "/api/v1/notifications"},
+		{path: "/api/v1/statuses/113589231846534032/context", expected: "/api/v1/statuses/:id/context"},
+		{path: "/api/v1/notifications/42/dismiss", expected: "/api/v1/notifications/:id/dismiss"},
+		{path: "/api/v2/instance", expected: "/api/v2/instance"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, metrics.Endpoint(tc.path))
+		})
+	}
+}
+
+func TestMastodonTransportRecordsLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: metrics.MastodonTransport(nil)}
+	resp, err := client.Get(server.URL + "/api/v1/statuses/123/context")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	count, err := testutil.GatherAndCount(metrics.Registry, "gmaps2osm_mastodon_request_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	body := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(body, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, body.Body.String(), `gmaps2osm_mastodon_request_duration_seconds_count{code="418",endpoint="/api/v1/statuses/:id/context",method="GET"} 1`)
+}
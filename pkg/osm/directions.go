@@ -0,0 +1,84 @@
+package osm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Point is a stop along a route
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// TravelMode is how a route is travelled
+type TravelMode string
+
+const (
+	// TravelModeAny leaves the choice of travel mode to the provider
+	TravelModeAny     TravelMode = ""
+	TravelModeCar     TravelMode = "car"
+	TravelModeBicycle TravelMode = "bicycle"
+	TravelModeFoot    TravelMode = "foot"
+)
+
+// RouteProvider is a Provider which can also link to directions
+type RouteProvider interface {
+	Provider
+
+	// RouteURL returns a link to directions through at least two points, in order
+	RouteURL(points []Point, mode TravelMode) string
+}
+
+// routeProviderFunc adapts URL builder functions to the RouteProvider interface
+type routeProviderFunc struct {
+	providerFunc
+	route func(points []Point, mode TravelMode) string
+}
+
+func (p routeProviderFunc) RouteURL(points []Point, mode TravelMode) string {
+	return p.route(points, mode)
+}
+
+// osmEngines are the openstreetmap.org routing engines for each travel mode
+var osmEngines = map[TravelMode]string{
+	TravelModeCar:     "fossgis_osrm_car",
+	TravelModeBicycle: "fossgis_osrm_bike",
+	TravelModeFoot:    "fossgis_osrm_foot",
+}
+
+// MakeOSMDirectionsUrl generates an openstreetmap.org directions URL. openstreetmap.org only routes
+// between two points, so any points in between are left out
+// Example: https://www.openstreetmap.org/directions?engine=fossgis_osrm_foot&route=51.5074,-0.1278;51.5014,-0.1419
+func MakeOSMDirectionsUrl(points []Point, mode TravelMode) string {
+	from, to := points[0], points[len(points)-1]
+	route := fmt.Sprintf("%g,%g;%g,%g", from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+
+	if engine, ok := osmEngines[mode]; ok {
+		return fmt.Sprintf("https://www.openstreetmap.org/directions?engine=%s&route=%s", engine, route)
+	}
+	return "https://www.openstreetmap.org/directions?route=" + route
+}
+
+// osmAppModes are OSMapp's names for each travel mode, which defaults to car
+var osmAppModes = map[TravelMode]string{
+	TravelModeCar:     "car",
+	TravelModeBicycle: "bike",
+	TravelModeFoot:    "walk",
+}
+
+// MakeOSMAppDirectionsUrl generates an OSMapp directions URL through every point
+// Example: https://osmapp.org/directions/walk/51.5074,-0.1278/51.5014,-0.1419
+func MakeOSMAppDirectionsUrl(points []Point, mode TravelMode) string {
+	osmAppMode, ok := osmAppModes[mode]
+	if !ok {
+		osmAppMode = "car"
+	}
+
+	stops := make([]string, 0, len(points))
+	for _, p := range points {
+		stops = append(stops, fmt.Sprintf("%g,%g", p.Latitude, p.Longitude))
+	}
+
+	return fmt.Sprintf("https://osmapp.org/directions/%s/%s", osmAppMode, strings.Join(stops, "/"))
+}
@@ -0,0 +1,74 @@
+package osm
+
+import "math"
+
+// Organic Maps "ge0" short links pack a zoom level and a location into URL-safe base64,
+// see https://github.com/organicmaps/organicmaps/blob/master/ge0/url_generator.cpp
+
+const (
+	ge0Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+	// Each encoded byte holds 3 bits of latitude and 3 bits of longitude
+	ge0LatLonBytes  = 9
+	ge0MaxCoordBits = 30
+)
+
+// encodeGe0 encodes the coordinates and zoom level as a 10 character ge0 string
+func encodeGe0(latitude float64, longitude float64, zoom int) string {
+	encoded := make([]byte, 0, ge0LatLonBytes+1)
+
+	var zoomIndex int
+	switch {
+	case zoom <= 4:
+		zoomIndex = 0
+	case zoom >= 20:
+		zoomIndex = 63
+	default:
+		zoomIndex = (zoom - 4) * 4
+	}
+	encoded = append(encoded, ge0Alphabet[zoomIndex])
+
+	maxValue := 1<<ge0MaxCoordBits - 1
+	lat := ge0LatToInt(latitude, maxValue)
+	lon := ge0LonToInt(longitude, maxValue)
+
+	for i, shift := 0, ge0MaxCoordBits-3; i < ge0LatLonBytes; i, shift = i+1, shift-3 {
+		latBits := lat >> shift & 7
+		lonBits := lon >> shift & 7
+		next := (latBits>>2&1)<<5 | (lonBits>>2&1)<<4 | (latBits>>1&1)<<3 | (lonBits>>1&1)<<2 | (latBits&1)<<1 | lonBits&1
+		encoded = append(encoded, ge0Alphabet[next])
+	}
+
+	return string(encoded)
+}
+
+// ge0LatToInt maps a latitude in [-90, 90] onto [0, maxValue]
+func ge0LatToInt(latitude float64, maxValue int) int {
+	x := (latitude + 90) / 180 * float64(maxValue)
+	if x < 0 {
+		return 0
+	}
+	if x > float64(maxValue) {
+		return maxValue
+	}
+	return int(x + 0.5)
+}
+
+// ge0LonToInt maps a longitude onto [0, maxValue], wrapping it into [-180, 180) first
+func ge0LonToInt(longitude float64, maxValue int) int {
+	var wrapped float64
+	if longitude >= 0 {
+		wrapped = math.Mod(longitude+180, 360) - 180
+	} else {
+		wrapped = math.Mod(longitude-180, 360) + 180
+		if wrapped >= 180 {
+			wrapped -= 360
+		}
+	}
+
+	x := (wrapped+180)/360*(float64(maxValue)+1) + 0.5
+	if x <= 0 || x >= float64(maxValue)+1 {
+		return 0
+	}
+	return int(x)
+}
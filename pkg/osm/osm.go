@@ -2,8 +2,33 @@ package osm
 
 import "fmt"
 
+// DefaultZoom is the map zoom level used when the source link doesn't specify one
+const DefaultZoom = 17
+
+// MaxZoom is the highest zoom level openstreetmap.org renders
+const MaxZoom = 19
+
 // MakeOSMAppUrl generates an OSMapp URL for the given coordinates
 // Example: https://osmapp.org/51.558,2.218
 func MakeOSMAppUrl(latitude float64, longitude float64) string {
 	return fmt.Sprintf("https://osmapp.org/%g,%g", latitude, longitude)
 }
+
+// MakeOSMUrl generates an openstreetmap.org URL with a marker at the given coordinates.
+// A zoom of 0 or less uses DefaultZoom
+// Example: https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=17/51.558/2.218
+func MakeOSMUrl(latitude float64, longitude float64, zoom int) string {
+	zoom = normaliseZoom(zoom)
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%g&mlon=%g#map=%d/%g/%g", latitude, longitude, zoom, latitude, longitude)
+}
+
+// normaliseZoom replaces a missing zoom with DefaultZoom and clamps it to MaxZoom
+func normaliseZoom(zoom int) int {
+	if zoom <= 0 {
+		return DefaultZoom
+	}
+	if zoom > MaxZoom {
+		return MaxZoom
+	}
+	return zoom
+}
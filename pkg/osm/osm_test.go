@@ -26,3 +26,23 @@ func TestMakeOSMAppUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeOSMUrl(t *testing.T) {
+	testCases := []struct {
+		name        string
+		latitude    float64
+		longitude   float64
+		zoom        int
+		expectedURL string
+	}{
+		{"Example from user", 51.558, 2.218, 15, "https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=15/51.558/2.218"},
+		{"Negatives", -12.0, -12.0, 10, "https://www.openstreetmap.org/?mlat=-12&mlon=-12#map=10/-12/-12"},
+		{"Unknown zoom uses default", 51.558, 2.218, 0, "https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=17/51.558/2.218"},
+		{"Zoom beyond OSM maximum is clamped", 51.558, 2.218, 21, "https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=19/51.558/2.218"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedURL, osm.MakeOSMUrl(tc.latitude, tc.longitude, tc.zoom))
+		})
+	}
+}
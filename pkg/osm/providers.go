@@ -0,0 +1,123 @@
+package osm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider builds links to a map service
+type Provider interface {
+	// Name is the identifier operators use to select the provider
+	Name() string
+
+	// URL returns a link showing the given coordinates. A zoom of 0 or less means unknown
+	URL(latitude float64, longitude float64, zoom int) string
+}
+
+// providerFunc adapts a URL builder function to the Provider interface
+type providerFunc struct {
+	name  string
+	build func(latitude float64, longitude float64, zoom int) string
+}
+
+func (p providerFunc) Name() string { return p.name }
+
+func (p providerFunc) URL(latitude float64, longitude float64, zoom int) string {
+	return p.build(latitude, longitude, zoom)
+}
+
+// registry holds all known providers by name
+var registry = map[string]Provider{}
+
+func init() {
+	Register(routeProviderFunc{providerFunc{"osmapp", func(lat, lon float64, _ int) string { return MakeOSMAppUrl(lat, lon) }}, MakeOSMAppDirectionsUrl})
+	Register(routeProviderFunc{providerFunc{"openstreetmap", MakeOSMUrl}, MakeOSMDirectionsUrl})
+	Register(providerFunc{"organicmaps", MakeOrganicMapsUrl})
+	Register(providerFunc{"organicmaps-app", MakeOrganicMapsAppUrl})
+	Register(providerFunc{"osmand", MakeOsmAndUrl})
+	Register(providerFunc{"qwant", MakeQwantMapsUrl})
+	Register(providerFunc{"mapy", MakeMapyUrl})
+	Register(providerFunc{"geo", MakeGeoUri})
+}
+
+// Register adds a provider to the registry, replacing any existing provider with the same name
+func Register(p Provider) {
+	registry[p.Name()] = p
+}
+
+// ProviderNames returns the names of all registered providers in alphabetical order
+func ProviderNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseProviders looks up a comma-separated list of provider names, keeping their order
+func ParseProviders(list string) ([]Provider, error) {
+	providers := make([]Provider, 0)
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		p, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown map provider %q, must be one of %s", name, strings.Join(ProviderNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("map provider %q listed more than once", name)
+		}
+
+		seen[name] = true
+		providers = append(providers, p)
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("at least one map provider is required")
+	}
+
+	return providers, nil
+}
+
+// MakeOrganicMapsUrl generates an Organic Maps web share link, which CoMaps also opens
+// Example: https://omaps.app/8wAAAAAAAA
+func MakeOrganicMapsUrl(latitude float64, longitude float64, zoom int) string {
+	return "https://omaps.app/" + encodeGe0(latitude, longitude, normaliseZoom(zoom))
+}
+
+// MakeOrganicMapsAppUrl generates a link that opens directly in the Organic Maps or CoMaps app
+// Example: om://8wAAAAAAAA
+func MakeOrganicMapsAppUrl(latitude float64, longitude float64, zoom int) string {
+	return "om://" + encodeGe0(latitude, longitude, normaliseZoom(zoom))
+}
+
+// MakeOsmAndUrl generates an OsmAnd web link with a pin at the given coordinates
+// Example: https://osmand.net/map?pin=51.558,2.218#17/51.558/2.218
+func MakeOsmAndUrl(latitude float64, longitude float64, zoom int) string {
+	return fmt.Sprintf("https://osmand.net/map?pin=%g,%g#%d/%g/%g", latitude, longitude, normaliseZoom(zoom), latitude, longitude)
+}
+
+// MakeQwantMapsUrl generates a Qwant Maps link to the given coordinates
+// Example: https://www.qwant.com/maps/place/latlon:51.558:2.218#map=17.00/51.558/2.218
+func MakeQwantMapsUrl(latitude float64, longitude float64, zoom int) string {
+	return fmt.Sprintf("https://www.qwant.com/maps/place/latlon:%g:%g#map=%d.00/%g/%g", latitude, longitude, normaliseZoom(zoom), latitude, longitude)
+}
+
+// MakeMapyUrl generates a Mapy.cz link with a marker at the given coordinates
+// Example: https://mapy.cz/zakladni?source=coor&id=2.218%2C51.558&x=2.218&y=51.558&z=17
+func MakeMapyUrl(latitude float64, longitude float64, zoom int) string {
+	return fmt.Sprintf("https://mapy.cz/zakladni?source=coor&id=%g%%2C%g&x=%g&y=%g&z=%d", longitude, latitude, longitude, latitude, normaliseZoom(zoom))
+}
+
+// MakeGeoUri generates an RFC 5870 geo: URI, which most mobile map apps open
+// Example: geo:51.558,2.218?z=17
+func MakeGeoUri(latitude float64, longitude float64, zoom int) string {
+	return fmt.Sprintf("geo:%g,%g?z=%d", latitude, longitude, normaliseZoom(zoom))
+}
@@ -0,0 +1,103 @@
+package osm_test
+
+import (
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/osm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderURLs(t *testing.T) {
+	testCases := []struct {
+		provider    string
+		latitude    float64
+		longitude   float64
+		zoom        int
+		expectedURL string
+	}{
+		{"osmapp", 51.558, 2.218, 15, "https://osmapp.org/51.558,2.218"},
+		{"openstreetmap", 51.558, 2.218, 15, "https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=15/51.558/2.218"},
+		{"organicmaps", 0, 0, 19, "https://omaps.app/8wAAAAAAAA"},
+		{"organicmaps-app", 0, 0, 19, "om://8wAAAAAAAA"},
+		{"organicmaps-app", -90, -180, 4, "om://AAAAAAAAAA"},
+		{"organicmaps-app", 90, 180, 0, "om://0qqqqqqqqq"},
+		{"osmand", 51.558, 2.218, 0, "https://osmand.net/map?pin=51.558,2.218#17/51.558/2.218"},
+		{"qwant", 51.558, 2.218, 12, "https://www.qwant.com/maps/place/latlon:51.558:2.218#map=12.00/51.558/2.218"},
+		{"mapy", 50.087, 14.421, 16, "https://mapy.cz/zakladni?source=coor&id=14.421%2C50.087&x=14.421&y=50.087&z=16"},
+		{"geo", -33.8688, 151.2093, 0, "geo:-33.8688,151.2093?z=17"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expectedURL, func(t *testing.T) {
+			providers, err := osm.ParseProviders(tc.provider)
+			require.NoError(t, err)
+			require.Len(t, providers, 1)
+			assert.Equal(t, tc.provider, providers[0].Name())
+			assert.Equal(t, tc.expectedURL, providers[0].URL(tc.latitude, tc.longitude, tc.zoom))
+		})
+	}
+}
+
+func TestParseProviders(t *testing.T) {
+	testCases := []struct {
+		name      string
+		list      string
+		expected  []string
+		shouldErr bool
+	}{
+		{name: "Default", list: "osmapp,openstreetmap", expected: []string{"osmapp", "openstreetmap"}},
+		{name: "Order is kept", list: "geo,osmand,osmapp", expected: []string{"geo", "osmand", "osmapp"}},
+		{name: "Whitespace and case are ignored", list: " OSMapp , organicmaps ", expected: []string{"osmapp", "organicmaps"}},
+		{name: "Unknown provider", list: "osmapp,googlemaps", shouldErr: true},
+		{name: "Duplicate provider", list: "osmapp,osmapp", shouldErr: true},
+		{name: "Empty list", list: " , ", shouldErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			providers, err := osm.ParseProviders(tc.list)
+			if tc.shouldErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			names := make([]string, 0, len(providers))
+			for _, p := range providers {
+				names = append(names, p.Name())
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestRouteProviderURLs(t *testing.T) {
+	points := []osm.Point{{Latitude: 51.5074, Longitude: -0.1278}, {Latitude: 51.5076, Longitude: -0.0994}, {Latitude: 51.5014, Longitude: -0.1419}}
+
+	testCases := []struct {
+		provider    string
+		mode        osm.TravelMode
+		expectedURL string
+	}{
+		{"openstreetmap", osm.TravelModeFoot, "https://www.openstreetmap.org/directions?engine=fossgis_osrm_foot&route=51.5074,-0.1278;51.5014,-0.1419"},
+		{"openstreetmap", osm.TravelModeBicycle, "https://www.openstreetmap.org/directions?engine=fossgis_osrm_bike&route=51.5074,-0.1278;51.5014,-0.1419"},
+		{"openstreetmap", osm.TravelModeAny, "https://www.openstreetmap.org/directions?route=51.5074,-0.1278;51.5014,-0.1419"},
+		{"osmapp", osm.TravelModeCar, "https://osmapp.org/directions/car/51.5074,-0.1278/51.5076,-0.0994/51.5014,-0.1419"},
+		{"osmapp", osm.TravelModeFoot, "https://osmapp.org/directions/walk/51.5074,-0.1278/51.5076,-0.0994/51.5014,-0.1419"},
+		{"osmapp", osm.TravelModeAny, "https://osmapp.org/directions/car/51.5074,-0.1278/51.5076,-0.0994/51.5014,-0.1419"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expectedURL, func(t *testing.T) {
+			providers, err := osm.ParseProviders(tc.provider)
+			require.NoError(t, err)
+			rp, ok := providers[0].(osm.RouteProvider)
+			require.True(t, ok, "%s should route", tc.provider)
+			assert.Equal(t, tc.expectedURL, rp.RouteURL(points, tc.mode))
+		})
+	}
+
+	providers, err := osm.ParseProviders("geo")
+	require.NoError(t, err)
+	_, ok := providers[0].(osm.RouteProvider)
+	assert.False(t, ok, "geo URIs can't describe routes")
+}
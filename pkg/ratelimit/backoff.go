@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// isThrottled reports whether resp asks us to slow down
+func isThrottled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// wait blocks until the destination isn't being backed off from and the rate limit allows a
+// request, or ctx is cancelled
+func (b *bucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		delay := time.Until(b.until)
+		b.mu.Unlock()
+
+		if delay <= 0 {
+			break
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		// The backoff may have been extended while waiting, so check again
+	}
+
+	return b.limiter.Wait(ctx)
+}
+
+// succeeded resets the backoff once the destination stops throttling
+func (b *bucket) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.throttled = 0
+}
+
+// throttle backs off from the destination after resp throttled a request, for as long as its
+// Retry-After header asks or exponentially longer for every throttled request in a row. It
+// returns false if Retry-After asks for longer than MaxBackoff, as retrying isn't worth the wait
+func (b *bucket) throttle(resp *http.Response, limits Limits) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.throttled++
+
+	backoff, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+	worthRetrying := true
+	if !ok {
+		backoff = limits.MinBackoff
+		for i := 1; i < b.throttled && backoff < limits.MaxBackoff; i++ {
+			backoff *= 2
+		}
+	} else if backoff > limits.MaxBackoff {
+		worthRetrying = false
+	}
+	backoff = min(backoff, limits.MaxBackoff)
+
+	if until := time.Now().Add(backoff); until.After(b.until) {
+		b.until = until
+	}
+	return worthRetrying
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
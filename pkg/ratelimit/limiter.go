@@ -1,26 +1,79 @@
 package ratelimit
 
 import (
+	"io"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/metrics"
+	"golang.org/x/time/rate"
 )
 
-// RateLimitedClient wraps an HTTP client with rate limiting
+// googleHostRegex matches Google's own hosts, e.g. www.google.com, maps.google.co.uk or consent.google.de
+var googleHostRegex = regexp.MustCompile(`(?:^|\.)google\.(?:com|[a-z]{2}(?:\.[a-z]{2})?)$`)
+
+// Limits configures how fast a RateLimitedClient may send requests to each destination
+type Limits struct {
+	// RequestsPerSecond is the sustained rate of requests to each destination
+	RequestsPerSecond float64
+
+	// Burst is how many requests to a destination may be sent at once before being limited
+	Burst int
+
+	// MaxRetries is how many times a HEAD or GET request is retried after a 429 or 503 response
+	MaxRetries int
+
+	// MinBackoff is how long to stop sending requests to a destination after it responds 429 or 503
+	// without a Retry-After header, doubling for every such response in a row. Defaults to 1s
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the backoff. Requests aren't retried if Retry-After asks for longer. Defaults to 1m
+	MaxBackoff time.Duration
+}
+
+// RateLimitedClient wraps an HTTP client with a token bucket rate limit per destination.
+// goo.gl's short link hosts share a bucket, as do Google's own domains, while every other
+// host gets a bucket of its own. Destinations which throttle requests are backed off from
 type RateLimitedClient struct {
-	client  *http.Client
-	limiter <-chan time.Time
+	client *http.Client
+	limits Limits
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket is the rate limit and backoff state for one destination
+type bucket struct {
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+
+	// until is when requests may be sent again after being throttled
+	until time.Time
+
+	// throttled is how many throttling responses in a row have been received
+	throttled int
 }
 
 // NewRateLimitedClient creates a new rate-limited HTTP client
-// requestsPerSecond determines how many requests are allowed per second
-func NewRateLimitedClient(maxRedirects int, requestsPerSecond float64) *RateLimitedClient {
-	// Calculate the interval between requests
-	interval := time.Duration(float64(time.Second) / requestsPerSecond)
+func NewRateLimitedClient(limits Limits) *RateLimitedClient {
+	if limits.Burst < 1 {
+		limits.Burst = 1
+	}
+	if limits.MinBackoff <= 0 {
+		limits.MinBackoff = time.Second
+	}
+	if limits.MaxBackoff <= 0 {
+		limits.MaxBackoff = time.Minute
+	}
 
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Don't follow redirects automatically - we handle them manually
-			// to read the Location header from the first redirect response
+			// Don't follow redirects automatically - the extractor walks the
+			// redirect chain itself so it can check every Location header
 			return http.ErrUseLastResponse
 		},
 		Timeout: 30 * time.Second,
@@ -28,13 +81,71 @@ func NewRateLimitedClient(maxRedirects int, requestsPerSecond float64) *RateLimi
 
 	return &RateLimitedClient{
 		client:  client,
-		limiter: time.Tick(interval),
+		limits:  limits,
+		buckets: make(map[string]*bucket),
 	}
 }
 
-// Do executes an HTTP request with rate limiting
+// Do executes an HTTP request once the rate limit for its destination allows, giving up
+// if the request's context is cancelled while waiting. HEAD and GET requests which are
+// throttled with a 429 or 503 response are retried up to MaxRetries times
 func (c *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
-	// Wait for the rate limiter to allow the request
-	<-c.limiter
-	return c.client.Do(req)
+	b := c.bucket(req.URL.Hostname())
+	retryable := (req.Method == http.MethodHead || req.Method == http.MethodGet) && req.Body == nil
+
+	for attempt := 0; ; attempt++ {
+		if err := b.wait(req.Context()); err != nil {
+			metrics.HTTPRequests.WithLabelValues(req.Method, metrics.StatusCode(nil, err)).Inc()
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req)
+		metrics.HTTPRequests.WithLabelValues(req.Method, metrics.StatusCode(resp, err)).Inc()
+		if err != nil || !isThrottled(resp) {
+			if err == nil {
+				b.succeeded()
+			}
+			return resp, err
+		}
+
+		// Back off from the destination even if this request won't be retried, so others wait too
+		worthRetrying := b.throttle(resp, c.limits)
+		if !retryable || !worthRetrying || attempt >= c.limits.MaxRetries {
+			return resp, nil
+		}
+
+		// The next wait lasts until the backoff has passed
+		metrics.HTTPRetries.WithLabelValues(Bucket(req.URL.Hostname())).Inc()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+	}
+}
+
+// bucket returns the rate limit state for requests to host, creating it if needed
+func (c *RateLimitedClient) bucket(host string) *bucket {
+	key := Bucket(host)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(c.limits.RequestsPerSecond), c.limits.Burst)}
+		c.buckets[key] = b
+	}
+	return b
+}
+
+// Bucket returns the name of the rate limit bucket requests to host are counted against
+func Bucket(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	switch {
+	case host == "goo.gl" || strings.HasSuffix(host, ".goo.gl"):
+		return "goo.gl"
+	case googleHostRegex.MatchString(host):
+		return "google.com"
+	default:
+		return host
+	}
 }
@@ -0,0 +1,214 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket(t *testing.T) {
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{host: "goo.gl", expected: "goo.gl"},
+		{host: "maps.app.goo.gl", expected: "goo.gl"},
+		{host: "www.google.com", expected: "google.com"},
+		{host: "maps.google.co.uk", expected: "google.com"},
+		{host: "consent.google.de", expected: "google.com"},
+		{host: "Google.COM.", expected: "google.com"},
+		{host: "notgoogle.com", expected: "notgoogle.com"},
+		{host: "example.org", expected: "example.org"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ratelimit.Bucket(tc.host))
+		})
+	}
+}
+
+// get makes a request to url through c, giving up on waiting for the rate limit after timeout
+// newNoContentServer serves empty responses to every request
+func newNoContentServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, c *ratelimit.RateLimitedClient, url string, timeout time.Duration) error {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	resp, err := c.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestRateLimitedClientAllowsBurstPerHost(t *testing.T) {
+	server := newNoContentServer(t)
+
+	// A token every 1000s, so nothing beyond the burst gets through during the test
+	c := ratelimit.NewRateLimitedClient(ratelimit.Limits{RequestsPerSecond: 0.001, Burst: 2})
+
+	require.NoError(t, get(t, c, server.URL, time.Second))
+	require.NoError(t, get(t, c, server.URL, time.Second))
+	assert.Error(t, get(t, c, server.URL, 100*time.Millisecond), "burst should be used up")
+
+	// The same server under another host name has its own bucket
+	localhost := "http://localhost:" + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+	assert.NoError(t, get(t, c, localhost, time.Second))
+}
+
+func TestRateLimitedClientGivesUpWhenContextCancelled(t *testing.T) {
+	c := ratelimit.NewRateLimitedClient(ratelimit.Limits{RequestsPerSecond: 0.001, Burst: 1})
+
+	server := newNoContentServer(t)
+	require.NoError(t, get(t, c, server.URL, time.Second))
+
+	// The next token is 1000s away, so this waits until cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Do(req)
+		done <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do didn't return after the context was cancelled")
+	}
+}
+
+// newThrottlingServer responds with each of responses in turn, then 204 No Content. Each response
+// is a status code and optional Retry-After header
+func newThrottlingServer(t *testing.T, responses ...[2]string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n > len(responses) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		code, _ := strconv.Atoi(responses[n-1][0])
+		if retryAfter := responses[n-1][1]; retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRateLimitedClientRetriesThrottledRequests(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		responses      [][2]string
+		expectCode     int
+		expectRequests int32
+		expectMinWait  time.Duration
+	}{
+		{
+			name:           "Retry-After seconds",
+			method:         http.MethodHead,
+			responses:      [][2]string{{"429", "0"}},
+			expectCode:     http.StatusNoContent,
+			expectRequests: 2,
+		},
+		{
+			name:           "Exponential backoff without Retry-After",
+			method:         http.MethodGet,
+			responses:      [][2]string{{"503", ""}, {"503", ""}},
+			expectCode:     http.StatusNoContent,
+			expectRequests: 3,
+			expectMinWait:  30 * time.Millisecond,
+		},
+		{
+			name:           "Gives up after max retries",
+			method:         http.MethodHead,
+			responses:      [][2]string{{"429", ""}, {"429", ""}, {"429", ""}, {"429", ""}},
+			expectCode:     http.StatusTooManyRequests,
+			expectRequests: 3,
+		},
+		{
+			name:           "Doesn't wait longer than max backoff",
+			method:         http.MethodHead,
+			responses:      [][2]string{{"429", "3600"}},
+			expectCode:     http.StatusTooManyRequests,
+			expectRequests: 1,
+		},
+		{
+			name:           "Doesn't retry POST",
+			method:         http.MethodPost,
+			responses:      [][2]string{{"503", "0"}},
+			expectCode:     http.StatusServiceUnavailable,
+			expectRequests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, requests := newThrottlingServer(t, tc.responses...)
+			c := ratelimit.NewRateLimitedClient(ratelimit.Limits{
+				RequestsPerSecond: 1000,
+				Burst:             1,
+				MaxRetries:        2,
+				MinBackoff:        10 * time.Millisecond,
+				MaxBackoff:        time.Second,
+			})
+
+			req, err := http.NewRequest(tc.method, server.URL, nil)
+			require.NoError(t, err)
+
+			start := time.Now()
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tc.expectCode, resp.StatusCode)
+			assert.Equal(t, tc.expectRequests, requests.Load())
+			assert.GreaterOrEqual(t, time.Since(start), tc.expectMinWait)
+		})
+	}
+}
+
+func TestRateLimitedClientBackoffGivesUpWhenContextCancelled(t *testing.T) {
+	server, _ := newThrottlingServer(t, [2]string{"429", "30"})
+	c := ratelimit.NewRateLimitedClient(ratelimit.Limits{RequestsPerSecond: 1000, Burst: 1, MaxRetries: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, server.URL, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = c.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -2,6 +2,7 @@ package reply
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 
 	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
@@ -9,78 +10,198 @@ import (
 	"go.uber.org/zap"
 )
 
-// Generator handles generating replies for Google Maps URLs
+// Options controls how replies are generated
+type Options struct {
+	// Providers are the map providers to link to, in order
+	Providers []osm.Provider
+
+	// KeepGCJ02 skips converting mainland China coordinates from GCJ-02 to WGS-84
+	KeepGCJ02 bool
+
+	// PlusCodes includes the plus code of each converted location in replies
+	PlusCodes bool
+}
+
+// Generator handles generating replies for map links
 type Generator struct {
 	extractor *gmaps.Extractor
+	opts      Options
 	logger    *zap.SugaredLogger
 }
 
 // NewGenerator creates a new reply generator
-func NewGenerator(extractor *gmaps.Extractor, logger *zap.SugaredLogger) *Generator {
+func NewGenerator(extractor *gmaps.Extractor, opts Options, logger *zap.SugaredLogger) *Generator {
 	return &Generator{
 		extractor: extractor,
+		opts:      opts,
 		logger:    logger,
 	}
 }
 
+// Link is a link to a converted location on a single map provider
+type Link struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url"`
+}
+
 // ConversionResult represents the result of converting a single URL
 type ConversionResult struct {
-	OriginalURL string
-	OSMUrl      string
-	OSMAppUrl   string
-	Error       error
+	// OriginalURL is the map link converted, or the coordinates as written in the text
+	OriginalURL string `json:"original_url"`
+
+	// Source is the name of the map service OriginalURL links to, e.g. "Google Maps"
+	Source string `json:"source,omitempty"`
+
+	// Coordinates are the location the links point to, nil if the conversion failed
+	Coordinates *gmaps.Coordinates `json:"coordinates,omitempty"`
+
+	Links []Link `json:"links,omitempty"`
+
+	// PlusCode is the plus code of Coordinates, if replies include them
+	PlusCode string `json:"plus_code,omitempty"`
+
+	Error error `json:"-"`
 }
 
-// GenerateReply processes the given texts, extracts Google Maps URLs, and generates a reply
-func (g *Generator) GenerateReply(ctx context.Context, texts ...string) (string, error) {
-	// Combine all texts and extract Google Maps URLs
-	combinedText := strings.Join(texts, " ")
-	googleMapsURLs := gmaps.ExtractGoogleMapsURLs(combinedText)
+// MarshalJSON encodes the result with the error as its message, as error values don't marshal themselves
+func (r ConversionResult) MarshalJSON() ([]byte, error) {
+	type result ConversionResult
 
-	if len(googleMapsURLs) == 0 {
-		return "No Google Maps URLs found", nil
+	var errMsg string
+	if r.Error != nil {
+		errMsg = r.Error.Error()
 	}
 
-	g.logger.Infow("Found Google Maps URLs", "count", len(googleMapsURLs), "urls", googleMapsURLs)
+	return json.Marshal(struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result(r), errMsg})
+}
 
-	// Convert each URL
-	results := make([]ConversionResult, 0, len(googleMapsURLs))
-	successCount := 0
+// NoLinksReply is the reply when there are no map links to convert
+const NoLinksReply = "No map links found"
+
+// GenerateReplyFromHTML processes the given status HTML contents, extracts map links, and generates a reply
+func (g *Generator) GenerateReplyFromHTML(ctx context.Context, contents ...string) (string, error) {
+	// Status contents are HTML fragments, so they can be combined just like plain text
+	combinedContent := strings.Join(contents, " ")
+	return g.generateReply(ctx, gmaps.ExtractMapURLsFromHTML(combinedContent))
+}
+
+// generateReply converts the given map links and formats the reply
+func (g *Generator) generateReply(ctx context.Context, mapURLs []string) (string, error) {
+	if len(mapURLs) == 0 {
+		return NoLinksReply, nil
+	}
+
+	g.logger.Infow("Found map links", "count", len(mapURLs), "urls", mapURLs)
+
+	return FormatReply(g.Convert(ctx, mapURLs)), nil
+}
+
+// Convert converts each of the given map links, returning a result for every URL in order
+func (g *Generator) Convert(ctx context.Context, mapURLs []string) []ConversionResult {
+	results := make([]ConversionResult, 0, len(mapURLs))
+
+	for _, url := range mapURLs {
+		source := sourceName(url)
 
-	for _, url := range googleMapsURLs {
 		coords, err := g.extractor.ExtractCoordinates(ctx, url)
 		if err != nil {
-			g.logger.Warnw("Failed to extract coordinates", "url", url, "error", err)
+			g.logger.Warnw("Failed to extract coordinates", "url", url, "source", source, "error", err)
 			results = append(results, ConversionResult{
 				OriginalURL: url,
+				Source:      source,
 				Error:       err,
 			})
 			continue
 		}
 
-		osmAppURL := osm.MakeOSMAppUrl(coords.Latitude, coords.Longitude)
-		g.logger.Infow("Successfully converted URL", "googleMaps", url, "osmApp", osmAppURL)
+		if coords.HasGCJ02() && !g.opts.KeepGCJ02 {
+			converted := coords.ToWGS84()
+			g.logger.Debugw("Converted GCJ-02 coordinates to WGS-84", "url", url, "gcj02", coords, "wgs84", converted)
+			coords = &converted
+		}
+
+		var plusCode string
+		if g.opts.PlusCodes {
+			plusCode = gmaps.EncodePlusCode(coords.Latitude, coords.Longitude)
+		}
+
+		links := g.makeLinks(coords)
+		g.logger.Infow("Successfully converted URL", "url", url, "source", source, "links", links)
 		results = append(results, ConversionResult{
 			OriginalURL: url,
-			OSMAppUrl:   osmAppURL,
+			Source:      source,
+			Coordinates: coords,
+			Links:       links,
+			PlusCode:    plusCode,
+		})
+	}
+
+	return results
+}
+
+// sourceName returns the name of the map service url links to, or "" if it isn't a known one
+func sourceName(url string) string {
+	if source := gmaps.SourceOf(url); source != nil {
+		return source.Name()
+	}
+	return ""
+}
+
+// makeLinks builds a link to coords for each configured provider. Providers which can route link
+// to directions along the coordinates' route, if they have one, and the rest to the destination
+func (g *Generator) makeLinks(coords *gmaps.Coordinates) []Link {
+	links := make([]Link, 0, len(g.opts.Providers))
+	for _, p := range g.opts.Providers {
+		url := p.URL(coords.Latitude, coords.Longitude, coords.Zoom)
+		if rp, ok := p.(osm.RouteProvider); ok && coords.Route != nil {
+			url = rp.RouteURL(routePoints(coords.Route), travelModes[coords.Route.Mode])
+		}
+
+		links = append(links, Link{
+			Provider: p.Name(),
+			URL:      url,
 		})
-		successCount++
 	}
+	return links
+}
 
-	// Generate the reply text
-	return g.formatReply(results, successCount)
+// travelModes maps Google Maps travel modes to those map providers route with. OpenStreetMap
+// has no public transport routing, so transit leaves the choice to the provider
+var travelModes = map[gmaps.TravelMode]osm.TravelMode{
+	gmaps.TravelModeDriving:   osm.TravelModeCar,
+	gmaps.TravelModeBicycling: osm.TravelModeBicycle,
+	gmaps.TravelModeWalking:   osm.TravelModeFoot,
 }
 
-// formatReply formats the conversion results into a reply message
-func (g *Generator) formatReply(results []ConversionResult, successCount int) (string, error) {
+// routePoints returns the waypoints of route as points for map providers
+func routePoints(route *gmaps.Route) []osm.Point {
+	points := make([]osm.Point, 0, len(route.Waypoints))
+	for _, waypoint := range route.Waypoints {
+		points = append(points, osm.Point{Latitude: waypoint.Latitude, Longitude: waypoint.Longitude})
+	}
+	return points
+}
+
+// FormatReply formats the conversion results into a reply message
+func FormatReply(results []ConversionResult) string {
+	successCount := 0
+	for _, result := range results {
+		if result.Error == nil {
+			successCount++
+		}
+	}
+
 	if successCount == 0 {
-		return "Couldn't convert Google Maps link(s) to OpenStreetMap", nil
+		return "Couldn't convert map link(s) to OpenStreetMap"
 	}
 
 	// Build the reply with all conversions (successful and failed)
 	var sb strings.Builder
 
-	sb.WriteString("Attempted to provide a link to OpenStreetMap for those Google Maps URLs:\n")
+	sb.WriteString("Attempted to provide a link to OpenStreetMap for those map links:\n")
 
 	for _, result := range results {
 		if sb.Len() > 0 {
@@ -90,17 +211,38 @@ func (g *Generator) formatReply(results []ConversionResult, successCount int) (s
 		if result.Error == nil {
 			// Successful conversion
 			sb.WriteString("Successfully converted ")
-			sb.WriteString(result.OriginalURL)
+			sb.WriteString(result.describe())
 			sb.WriteString(" to ")
-			sb.WriteString(result.OSMAppUrl)
-			sb.WriteString(" or ")
-			sb.WriteString(result.OSMUrl)
+			for i, link := range result.Links {
+				if i > 0 {
+					sb.WriteString(" or ")
+				}
+				sb.WriteString(link.URL)
+			}
+			if result.PlusCode != "" {
+				sb.WriteString(" (plus code ")
+				sb.WriteString(result.PlusCode)
+				sb.WriteString(")")
+			}
 		} else {
 			// Failed conversion - inform the user
 			sb.WriteString("Couldn't convert ")
-			sb.WriteString(result.OriginalURL)
+			sb.WriteString(result.describe())
 		}
 	}
 
-	return sb.String(), nil
+	return sb.String()
+}
+
+// describe names the link the result is for along with its source, e.g. "Apple Maps link https://maps.apple.com/?ll=1,2",
+// or the coordinates it is for, e.g. "coordinates 51.5074, -0.1278"
+func (r ConversionResult) describe() string {
+	switch r.Source {
+	case "":
+		return r.OriginalURL
+	case gmaps.CoordinatesSourceName:
+		return "coordinates " + r.OriginalURL
+	default:
+		return r.Source + " link " + r.OriginalURL
+	}
 }
@@ -0,0 +1,168 @@
+package reply_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply/replytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateReplyFromText(t *testing.T) {
+	testCases := []struct {
+		name      string
+		providers string
+		text      string
+		expected  string
+	}{
+		{
+			name:     "No URLs",
+			text:     "Just saying hello",
+			expected: "No map links found",
+		},
+		{
+			name: "Single URL with zoom",
+			text: "Meet here https://www.google.com/maps/@51.558,2.218,15z",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Google Maps link https://www.google.com/maps/@51.558,2.218,15z to https://osmapp.org/51.558,2.218 or https://www.openstreetmap.org/?mlat=51.558&mlon=2.218#map=15/51.558/2.218",
+		},
+		{
+			name: "Mixed success and failure",
+			text: "https://maps.google.com/maps?q=51.5074,-0.1278 and https://www.google.com/maps/search/restaurants",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Google Maps link https://maps.google.com/maps?q=51.5074,-0.1278 to https://osmapp.org/51.5074,-0.1278 or https://www.openstreetmap.org/?mlat=51.5074&mlon=-0.1278#map=17/51.5074/-0.1278\n\n" +
+				"Couldn't convert Google Maps link https://www.google.com/maps/search/restaurants",
+		},
+		{
+			name:      "Custom providers in order",
+			providers: "geo,organicmaps",
+			text:      "Meet here https://www.google.com/maps/@0,0,19z",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Google Maps link https://www.google.com/maps/@0,0,19z to geo:0,0?z=19 or https://omaps.app/8wAAAAAAAA",
+		},
+		{
+			name:      "Directions link to routes where providers support them",
+			providers: "openstreetmap,geo",
+			text:      "Party here https://www.google.com/maps/dir/51.5074,-0.1278/51.5014,-0.1419/data=!4m2!4m1!3e2",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Google Maps link https://www.google.com/maps/dir/51.5074,-0.1278/51.5014,-0.1419/data=!4m2!4m1!3e2 to https://www.openstreetmap.org/directions?engine=fossgis_osrm_foot&route=51.5074,-0.1278;51.5014,-0.1419 or geo:51.5014,-0.1419?z=17",
+		},
+		{
+			name:      "Links to other map services",
+			providers: "geo",
+			text:      "https://maps.apple.com/?ll=50.894967,4.341626&z=16 or https://yandex.ru/maps/?ll=37.6173,55.7558&z=12",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted Apple Maps link https://maps.apple.com/?ll=50.894967,4.341626&z=16 to geo:50.894967,4.341626?z=16\n\n" +
+				"Successfully converted Yandex Maps link https://yandex.ru/maps/?ll=37.6173,55.7558&z=12 to geo:55.7558,37.6173?z=12",
+		},
+		{
+			name:      "Coordinates written out in text",
+			providers: "geo",
+			text:      "Either 51°30′26″N 0°7′39″W or geo:48.8584,2.2945?z=16, but not at 19.30, 20.45",
+			expected: "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n" +
+				"Successfully converted coordinates 51°30′26″N 0°7′39″W to geo:51.507222,-0.1275?z=17\n\n" +
+				"Successfully converted coordinates geo:48.8584,2.2945?z=16 to geo:48.8584,2.2945?z=16",
+		},
+		{
+			name:     "Nothing converts",
+			text:     "https://www.google.com/maps/search/restaurants",
+			expected: "Couldn't convert map link(s) to OpenStreetMap",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.providers == "" {
+				tc.providers = "osmapp,openstreetmap"
+			}
+			generator := replytest.NewGenerator(t, tc.providers, reply.Options{})
+
+			text, err := generator.GenerateReplyFromHTML(context.Background(), tc.text)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, text)
+		})
+	}
+}
+
+func TestGenerateReplyFromHTML(t *testing.T) {
+	generator := replytest.NewGenerator(t, "openstreetmap", reply.Options{})
+
+	mention := `<p><span class="h-card"><a href="https://c.im/@gMapsToOSM" class="u-url mention">@<span>gMapsToOSM</span></a></span> what about this?</p>`
+	parent := `<p>Meet at <a href="https://maps.google.com/maps?ll=40.7128,-74.0060&amp;z=11"><span class="invisible">https://</span><span class="ellipsis">maps.google.com/maps?ll=40.7128</span><span class="invisible">,-74.0060&amp;z=11</span></a></p>`
+
+	text, err := generator.GenerateReplyFromHTML(context.Background(), mention, parent)
+	require.NoError(t, err)
+	assert.Equal(t, "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n"+
+		"Successfully converted Google Maps link https://maps.google.com/maps?ll=40.7128,-74.0060&z=11 to https://www.openstreetmap.org/?mlat=40.7128&mlon=-74.006#map=11/40.7128/-74.006", text)
+}
+
+func TestGenerateReplyConvertsGCJ02(t *testing.T) {
+	testCases := []struct {
+		name      string
+		keepGCJ02 bool
+		expected  string
+	}{
+		{
+			name:     "Converted to WGS-84 by default",
+			expected: "geo:39.911954,116.377817?z=17",
+		},
+		{
+			name:      "Kept as GCJ-02 when disabled",
+			keepGCJ02: true,
+			expected:  "geo:39.91334545536069,116.38404722455657?z=17",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generator := replytest.NewGenerator(t, "geo", reply.Options{KeepGCJ02: tc.keepGCJ02})
+
+			text, err := generator.GenerateReplyFromHTML(context.Background(), "https://www.google.com/maps/@39.91334545536069,116.38404722455657,17z")
+			require.NoError(t, err)
+			assert.Contains(t, text, " to "+tc.expected)
+		})
+	}
+}
+
+func TestGenerateReplyWithPlusCodes(t *testing.T) {
+	generator := replytest.NewGenerator(t, "osmapp", reply.Options{PlusCodes: true})
+
+	text, err := generator.GenerateReplyFromHTML(context.Background(), "https://www.google.com/maps/@51.5074,-0.1278,17z and https://www.google.com/maps/search/restaurants")
+	require.NoError(t, err)
+	assert.Equal(t, "Attempted to provide a link to OpenStreetMap for those map links:\n\n\n"+
+		"Successfully converted Google Maps link https://www.google.com/maps/@51.5074,-0.1278,17z to https://osmapp.org/51.5074,-0.1278 (plus code 9C3XGV4C+XV)\n\n"+
+		"Couldn't convert Google Maps link https://www.google.com/maps/search/restaurants", text)
+
+	results := generator.Convert(context.Background(), []string{"9C3XGV4C+XV"})
+	require.Len(t, results, 1)
+	assert.Equal(t, "9C3XGV4C+XV", results[0].PlusCode, "Decoding and encoding a plus code gives it back")
+}
+
+func TestConvertResultsMarshalJSON(t *testing.T) {
+	generator := replytest.NewGenerator(t, "osmapp", reply.Options{})
+
+	results := generator.Convert(context.Background(), []string{
+		"https://www.google.com/maps/@51.558,2.218,15z",
+		"https://www.google.com/maps/search/restaurants",
+	})
+	require.Len(t, results, 2)
+
+	raw, err := json.Marshal(results)
+	require.NoError(t, err)
+
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+
+	assert.Equal(t, "https://www.google.com/maps/@51.558,2.218,15z", decoded[0]["original_url"])
+	assert.Equal(t, map[string]any{"latitude": 51.558, "longitude": 2.218, "zoom": 15.0, "datum": "WGS-84"}, decoded[0]["coordinates"])
+	assert.Equal(t, []any{map[string]any{"provider": "osmapp", "url": "https://osmapp.org/51.558,2.218"}}, decoded[0]["links"])
+	assert.NotContains(t, decoded[0], "error")
+	assert.NotContains(t, decoded[0], "plus_code", "Plus codes are only included when enabled")
+
+	assert.Equal(t, "https://www.google.com/maps/search/restaurants", decoded[1]["original_url"])
+	assert.NotContains(t, decoded[1], "coordinates")
+	assert.Contains(t, decoded[1]["error"], "failed to fetch URL")
+}
@@ -0,0 +1,34 @@
+// Package replytest provides reply generators for tests which convert links without going online
+package replytest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/gmaps"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/osm"
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/reply"
+	"go.uber.org/zap/zaptest"
+)
+
+// OfflineHTTPClient fails every request, so only links with their coordinates inline convert
+type OfflineHTTPClient struct{}
+
+func (OfflineHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return nil, http.ErrHandlerTimeout
+}
+
+// NewGenerator creates a generator linking to providers, a comma separated list as for --providers,
+// which converts links offline. Any providers in opts are replaced
+func NewGenerator(t testing.TB, providers string, opts reply.Options) *reply.Generator {
+	t.Helper()
+
+	parsed, err := osm.ParseProviders(providers)
+	if err != nil {
+		t.Fatalf("invalid providers %q: %v", providers, err)
+	}
+	opts.Providers = parsed
+
+	logger := zaptest.NewLogger(t).Sugar()
+	return reply.NewGenerator(gmaps.NewExtractor(OfflineHTTPClient{}, 5, logger), opts, logger)
+}
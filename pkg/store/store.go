@@ -0,0 +1,279 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// Outcome describes how the bot handled a status
+type Outcome string
+
+const (
+	// OutcomeReplied means the bot posted a reply to the status
+	OutcomeReplied Outcome = "replied"
+
+	// OutcomeAlreadyReplied means a reply from the bot was found on the server
+	OutcomeAlreadyReplied Outcome = "already-replied"
+)
+
+// Record is what the store remembers about a handled status
+type Record struct {
+	StatusID  string    `json:"status_id"`
+	ReplyID   string    `json:"reply_id,omitempty"`
+	Outcome   Outcome   `json:"outcome"`
+	HandledAt time.Time `json:"handled_at"`
+}
+
+var (
+	metaBucket        = []byte("meta")
+	statusesBucket    = []byte("statuses")
+	resolutionsBucket = []byte("resolutions")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migrations upgrade the database schema, migrations[i] moves it from version i to i+1.
+// Only ever append to this list so existing databases can be upgraded in place
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: handled statuses keyed by status ID
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(statusesBucket)
+		return err
+	},
+	// 2: cached link resolutions keyed by URL
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(resolutionsBucket)
+		return err
+	},
+	// 3: cached link resolutions record the datum of their source, so older ones are dropped
+	func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(resolutionsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(resolutionsBucket)
+		return err
+	},
+}
+
+// resolution is how a cached link resolution is stored
+type resolution struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Store is an on-disk record of the statuses the bot has handled
+type Store struct {
+	db     *bolt.DB
+	logger *zap.SugaredLogger
+}
+
+// Open opens or creates the store at path and migrates it to the latest schema
+func Open(path string, logger *zap.SugaredLogger) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %w", path, err)
+	}
+
+	s := &Store{
+		db:     db,
+		logger: logger,
+	}
+
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// migrate applies any migrations the database hasn't seen yet
+func (s *Store) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		version := 0
+		if raw := meta.Get(schemaVersionKey); raw != nil {
+			version, err = strconv.Atoi(string(raw))
+			if err != nil {
+				return fmt.Errorf("invalid schema version %q: %w", raw, err)
+			}
+		}
+
+		if version > len(migrations) {
+			return fmt.Errorf("state file schema version %d is newer than supported version %d", version, len(migrations))
+		}
+
+		for ; version < len(migrations); version++ {
+			s.logger.Infow("Migrating state file", "from", version, "to", version+1)
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration to schema version %d failed: %w", version+1, err)
+			}
+		}
+
+		return meta.Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+	})
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the record for statusID, or nil if the status hasn't been handled
+func (s *Store) Get(statusID string) (*Record, error) {
+	var record *Record
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(statusesBucket).Get([]byte(statusID))
+		if raw == nil {
+			return nil
+		}
+
+		record = &Record{}
+		return json.Unmarshal(raw, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record for status %s: %w", statusID, err)
+	}
+
+	return record, nil
+}
+
+// Put saves the record, replacing any existing record for the same status
+func (s *Store) Put(record Record) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusesBucket).Put([]byte(record.StatusID), raw)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save record for status %s: %w", record.StatusID, err)
+	}
+
+	return nil
+}
+
+// Prune deletes records handled before cutoff and returns how many were removed
+func (s *Store) Prune(cutoff time.Time) (int, error) {
+	pruned := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(statusesBucket)
+
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				s.logger.Warnw("Dropping unreadable state record", "statusID", string(k), "error", err)
+				stale = append(stale, k)
+				return nil
+			}
+			if record.HandledAt.Before(cutoff) {
+				stale = append(stale, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(stale)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune state file: %w", err)
+	}
+
+	return pruned, nil
+}
+
+// GetResolution returns the cached resolution of url and when it expires, or nil if there is none
+func (s *Store) GetResolution(url string) ([]byte, time.Time, error) {
+	var res *resolution
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(resolutionsBucket).Get([]byte(url))
+		if raw == nil {
+			return nil
+		}
+
+		res = &resolution{}
+		return json.Unmarshal(raw, res)
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read cached resolution of %s: %w", url, err)
+	}
+	if res == nil {
+		return nil, time.Time{}, nil
+	}
+
+	return res.Value, res.ExpiresAt, nil
+}
+
+// PutResolution caches the resolution of url until expiresAt, replacing any existing one
+func (s *Store) PutResolution(url string, value []byte, expiresAt time.Time) error {
+	raw, err := json.Marshal(resolution{Value: value, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resolutionsBucket).Put([]byte(url), raw)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save cached resolution of %s: %w", url, err)
+	}
+
+	return nil
+}
+
+// PruneResolutions deletes cached resolutions which expired before now and returns how many were removed
+func (s *Store) PruneResolutions(now time.Time) (int, error) {
+	pruned := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resolutionsBucket)
+
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var res resolution
+			if err := json.Unmarshal(v, &res); err != nil || res.ExpiresAt.Before(now) {
+				stale = append(stale, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(stale)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune cached resolutions: %w", err)
+	}
+
+	return pruned, nil
+}
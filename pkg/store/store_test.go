@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RichardoC/gMapsToOSM-mastodon-bot/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStoreRecordsSurviveRestart(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	s, err := store.Open(path, logger)
+	require.NoError(t, err)
+
+	record, err := s.Get("123")
+	require.NoError(t, err)
+	assert.Nil(t, record, "Unknown statuses should have no record")
+
+	handledAt := time.Date(2025, 12, 3, 19, 47, 45, 0, time.UTC)
+	require.NoError(t, s.Put(store.Record{
+		StatusID:  "123",
+		ReplyID:   "456",
+		Outcome:   store.OutcomeReplied,
+		HandledAt: handledAt,
+	}))
+	require.NoError(t, s.Close())
+
+	// Reopen as if the bot had restarted
+	s, err = store.Open(path, logger)
+	require.NoError(t, err)
+	defer s.Close()
+
+	record, err = s.Get("123")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "456", record.ReplyID)
+	assert.Equal(t, store.OutcomeReplied, record.Outcome)
+	assert.True(t, handledAt.Equal(record.HandledAt))
+}
+
+func TestStorePrune(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "state.db"), zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer s.Close()
+
+	now := time.Now()
+	require.NoError(t, s.Put(store.Record{StatusID: "old", Outcome: store.OutcomeReplied, HandledAt: now.Add(-48 * time.Hour)}))
+	require.NoError(t, s.Put(store.Record{StatusID: "new", Outcome: store.OutcomeAlreadyReplied, HandledAt: now}))
+
+	pruned, err := s.Prune(now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	record, err := s.Get("old")
+	require.NoError(t, err)
+	assert.Nil(t, record, "Old record should have been pruned")
+
+	record, err = s.Get("new")
+	require.NoError(t, err)
+	assert.NotNil(t, record, "Recent record should be kept")
+}
+
+func TestStoreResolutions(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "state.db"), zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer s.Close()
+
+	value, _, err := s.GetResolution("https://maps.app.goo.gl/unknown")
+	require.NoError(t, err)
+	assert.Nil(t, value, "Unknown links should have no resolution")
+
+	now := time.Now()
+	require.NoError(t, s.PutResolution("https://maps.app.goo.gl/old", []byte(`{"error":"not found"}`), now.Add(-time.Minute)))
+	require.NoError(t, s.PutResolution("https://maps.app.goo.gl/new", []byte(`{"pattern":"search"}`), now.Add(time.Hour)))
+
+	value, expiresAt, err := s.GetResolution("https://maps.app.goo.gl/new")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"pattern":"search"}`, string(value))
+	assert.True(t, now.Add(time.Hour).Equal(expiresAt))
+
+	pruned, err := s.PruneResolutions(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	value, _, err = s.GetResolution("https://maps.app.goo.gl/old")
+	require.NoError(t, err)
+	assert.Nil(t, value, "Expired resolution should have been pruned")
+}
+
+func TestStoreRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte("schema_version"), []byte("99"))
+	}))
+	require.NoError(t, db.Close())
+
+	_, err = store.Open(path, zaptest.NewLogger(t).Sugar())
+	assert.ErrorContains(t, err, "newer than supported")
+}